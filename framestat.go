@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// frameStatEntry describes the goroutines passing through a function, or a
+// single line of one. Exclusive counts goroutines with it as their top
+// frame, Inclusive counts goroutines with it anywhere on the stack, and the
+// wait times are of those inclusive goroutines.
+type frameStatEntry struct {
+	Function   string
+	Location   string `json:",omitempty"`
+	Exclusive  int
+	Inclusive  int
+	MedianWait time.Duration
+	MaxWait    time.Duration
+	Callers    []string
+}
+
+type frameStatOptions struct {
+	// by is function or line
+	by string
+	// count is the number of entries to show, or all of them if zero
+	count int
+}
+
+func checkFrameStatBy(by string) error {
+	switch by {
+	case "function", "line":
+		return nil
+	default:
+		return fmt.Errorf("unrecognized framestat grouping: %q\nvalid options are: function, line", by)
+	}
+}
+
+type frameStatFormatter interface {
+	formatFrameStats(io.Writer, []frameStatEntry) error
+}
+
+func computeFrameStats(stacks []*util.Stack, opts frameStatOptions) []frameStatEntry {
+	key := func(f *util.Frame) string {
+		if opts.by == "line" {
+			return f.Location()
+		}
+		return f.Function
+	}
+
+	type acc struct {
+		entry   frameStatEntry
+		stacks  []*util.Stack
+		callers map[string]bool
+	}
+	accs := make(map[string]*acc)
+
+	for _, s := range stacks {
+		seen := make(map[string]bool)
+		for i := range s.Frames {
+			f := &s.Frames[i]
+			if f.Collapsed > 0 {
+				continue
+			}
+
+			k := key(f)
+			a, ok := accs[k]
+			if !ok {
+				a = &acc{callers: make(map[string]bool)}
+				a.entry.Function = f.Function
+				if opts.by == "line" {
+					a.entry.Location = k
+				}
+				accs[k] = a
+			}
+			if i+1 < len(s.Frames) && s.Frames[i+1].Collapsed == 0 {
+				a.callers[key(&s.Frames[i+1])] = true
+			}
+
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			if i == 0 {
+				a.entry.Exclusive++
+			}
+			a.entry.Inclusive++
+			a.stacks = append(a.stacks, s)
+		}
+	}
+
+	var entries []frameStatEntry
+	for _, a := range accs {
+		ws := compWaitStats(a.stacks)
+		a.entry.MedianWait = ws.Median
+		a.entry.MaxWait = ws.Max
+		for c := range a.callers {
+			a.entry.Callers = append(a.entry.Callers, c)
+		}
+		sort.Strings(a.entry.Callers)
+		entries = append(entries, a.entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Inclusive != b.Inclusive {
+			return a.Inclusive > b.Inclusive
+		}
+		if a.Exclusive != b.Exclusive {
+			return a.Exclusive > b.Exclusive
+		}
+		if a.Function != b.Function {
+			return a.Function < b.Function
+		}
+		return a.Location < b.Location
+	})
+
+	if opts.count > 0 && len(entries) > opts.count {
+		entries = entries[:opts.count]
+	}
+	return entries
+}
+
+func (t *defaultFormatter) formatFrameStats(w io.Writer, entries []frameStatEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "excl\tincl\tmed wait\tmax wait\tframe\n")
+	for _, e := range entries {
+		name := e.Function
+		if e.Location != "" {
+			name = e.Location + " " + e.Function
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\n", e.Exclusive, e.Inclusive, formatDuration(e.MedianWait), formatDuration(e.MaxWait), name)
+		for _, c := range e.Callers {
+			fmt.Fprintf(tw, "\t\t\t\t  called from %s\n", c)
+		}
+	}
+	return tw.Flush()
+}
+
+func (j *jsonFormatter) formatFrameStats(w io.Writer, entries []frameStatEntry) error {
+	return json.NewEncoder(w).Encode(entries)
+}
+
+func (n *ndjsonFormatter) formatFrameStats(w io.Writer, entries []frameStatEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvFormatter) formatFrameStats(w io.Writer, entries []frameStatEntry) error {
+	cw := c.writer(w)
+	cw.Write([]string{"function", "location", "exclusive", "inclusive", "median_wait_seconds", "max_wait_seconds", "callers"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Function,
+			e.Location,
+			strconv.Itoa(e.Exclusive),
+			strconv.Itoa(e.Inclusive),
+			strconv.FormatInt(int64(e.MedianWait.Seconds()), 10),
+			strconv.FormatInt(int64(e.MaxWait.Seconds()), 10),
+			strings.Join(e.Callers, ";"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (t *templateFormatter) formatFrameStats(w io.Writer, entries []frameStatEntry) error {
+	for _, e := range entries {
+		if err := t.execute(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
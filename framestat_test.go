@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+func TestComputeFrameStats(t *testing.T) {
+	withWait := func(s *util.Stack, d time.Duration) *util.Stack {
+		s.WaitTime = d
+		return s
+	}
+	stacks := []*util.Stack{
+		// recursion only counts once, but both callers are recorded
+		withWait(testStack("select", "a.wait", "a.loop", "a.loop", "main.main"), time.Minute),
+		withWait(testStack("select", "a.wait", "a.loop", "b.run"), 3*time.Minute),
+		withWait(testStack("running", "a.loop", "main.main"), 2*time.Minute),
+	}
+
+	expected := []frameStatEntry{
+		{Function: "a.loop", Exclusive: 1, Inclusive: 3, MedianWait: 2 * time.Minute, MaxWait: 3 * time.Minute, Callers: []string{"a.loop", "b.run", "main.main"}},
+		{Function: "a.wait", Exclusive: 2, Inclusive: 2, MedianWait: 3 * time.Minute, MaxWait: 3 * time.Minute, Callers: []string{"a.loop"}},
+		{Function: "main.main", Exclusive: 0, Inclusive: 2, MedianWait: 2 * time.Minute, MaxWait: 2 * time.Minute},
+		{Function: "b.run", Exclusive: 0, Inclusive: 1, MedianWait: 3 * time.Minute, MaxWait: 3 * time.Minute},
+	}
+	got := computeFrameStats(stacks, frameStatOptions{by: "function"})
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected\n%+v\ngot\n%+v", expected, got)
+	}
+
+	if got := computeFrameStats(stacks, frameStatOptions{by: "function", count: 2}); !reflect.DeepEqual(got, expected[:2]) {
+		t.Errorf("expected the top 2 entries, got %+v", got)
+	}
+
+	// by line, each call site of a recursive function is separate
+	s := testStack("select", "a.loop", "a.loop")
+	s.Frames[0].File, s.Frames[0].Line = "/x/a.go", 10
+	s.Frames[1].File, s.Frames[1].Line = "/x/a.go", 12
+	expected = []frameStatEntry{
+		{Function: "a.loop", Location: "/x/a.go:10", Exclusive: 1, Inclusive: 1, Callers: []string{"/x/a.go:12"}},
+		{Function: "a.loop", Location: "/x/a.go:12", Exclusive: 0, Inclusive: 1},
+	}
+	if got := computeFrameStats([]*util.Stack{s}, frameStatOptions{by: "line"}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, got)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// htmlFormatter writes a self contained HTML report that can be attached to
+// a ticket and opened offline.
+type htmlFormatter struct {
+	linker *util.Linker
+}
+
+type htmlCount struct {
+	Name  string
+	Count int
+}
+
+type htmlGroup struct {
+	Count  int
+	States []htmlCount
+	Wait   waitStats
+	Rep    *util.Stack
+}
+
+type htmlReport struct {
+	Total     int
+	Summaries []summary
+	States    []htmlCount
+	Waits     []htmlCount
+	Groups    []htmlGroup
+}
+
+func (h *htmlFormatter) formatSummaries(w io.Writer, summaries []summary) error {
+	total := 0
+	for _, s := range summaries {
+		total += s.Count
+	}
+	return h.execute(w, &htmlReport{
+		Total:     total,
+		Summaries: summaries,
+	})
+}
+
+func (h *htmlFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
+	report := &htmlReport{
+		Total:     len(stacks),
+		Summaries: summarize(stacks),
+		States:    countBy(stacks, func(s *util.Stack) string { return s.State }),
+		Waits:     countBy(stacks, waitBucket),
+	}
+
+	groups := groupStacks(stacks, uniqueKey)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Stacks) > len(groups[j].Stacks)
+	})
+	for _, g := range groups {
+		report.Groups = append(report.Groups, htmlGroup{
+			Count:  len(g.Stacks),
+			States: countBy(g.Stacks, func(s *util.Stack) string { return s.State }),
+			Wait:   compWaitStats(g.Stacks),
+			Rep:    g.Rep,
+		})
+	}
+
+	return h.execute(w, report)
+}
+
+func (h *htmlFormatter) execute(w io.Writer, report *htmlReport) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"frameURL": func(f util.Frame) string {
+			if h.linker == nil {
+				return ""
+			}
+			return h.linker.URL(&f)
+		},
+		"duration":    formatDuration,
+		"topFunction": topFunctionKey,
+	}).Parse(htmlTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, report)
+}
+
+// countBy counts stacks by the given key, most common first.
+func countBy(stacks []*util.Stack, key func(*util.Stack) string) []htmlCount {
+	var counts []htmlCount
+	for _, g := range groupStacks(stacks, key) {
+		counts = append(counts, htmlCount{
+			Name:  g.Key,
+			Count: len(g.Stacks),
+		})
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+	return counts
+}
+
+// waitBucket groups wait times into coarse ranges for the breakdown table.
+func waitBucket(s *util.Stack) string {
+	switch {
+	case s.WaitTime < time.Minute:
+		return "< 1m"
+	case s.WaitTime < 10*time.Minute:
+		return "1m - 10m"
+	case s.WaitTime < time.Hour:
+		return "10m - 1h"
+	default:
+		return ">= 1h"
+	}
+}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>stackparse report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+td.n { text-align: right; }
+.tables { display: flex; gap: 2em; flex-wrap: wrap; align-items: flex-start; }
+details { border: 1px solid #ddd; margin: 4px 0; padding: 4px 8px; }
+summary { cursor: pointer; }
+pre { margin: 4px 0; }
+.std { color: #888; }
+#search { width: 40em; padding: 4px; margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>stackparse report</h1>
+<p>{{.Total}} goroutines</p>
+
+<div class="tables">
+<table>
+<tr><th>top function</th><th>count</th></tr>
+{{range .Summaries}}<tr><td>{{.Function}}</td><td class="n">{{.Count}}</td></tr>
+{{end}}</table>
+{{if .States}}
+<table>
+<tr><th>state</th><th>count</th></tr>
+{{range .States}}<tr><td>{{.Name}}</td><td class="n">{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Waits}}
+<table>
+<tr><th>wait</th><th>count</th></tr>
+{{range .Waits}}<tr><td>{{.Name}}</td><td class="n">{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}</div>
+{{if .Groups}}
+<h2>Groups</h2>
+<input id="search" type="search" placeholder="search frames">
+<div id="groups">
+{{range .Groups}}<details class="group">
+<summary>{{.Count}} &times; {{topFunction .Rep}} [{{range $i, $s := .States}}{{if $i}}, {{end}}{{$s.Name}}: {{$s.Count}}{{end}}] wait av/min/max/med: {{duration .Wait.Average}}/{{duration .Wait.Min}}/{{duration .Wait.Max}}/{{duration .Wait.Median}}</summary>
+<pre>{{.Rep.Header}}
+{{range .Rep.Frames}}<span{{if .IsStdlib}} class="std"{{end}}>{{.String}}{{with frameURL .}} <a href="{{.}}">source</a>{{end}}</span>
+{{end}}{{if .Rep.CreatedBy.Function}}{{.Rep.CreatedBy.String}}{{end}}</pre>
+</details>
+{{end}}</div>
+<script>
+document.getElementById("search").addEventListener("input", function(e) {
+  var q = e.target.value.toLowerCase();
+  var groups = document.querySelectorAll("#groups .group");
+  for (var i = 0; i < groups.length; i++) {
+    var match = q === "" || groups[i].textContent.toLowerCase().indexOf(q) >= 0;
+    groups[i].style.display = match ? "" : "none";
+    if (q !== "" && match) {
+      groups[i].open = true;
+    }
+  }
+});
+</script>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+func TestHTMLFormatter(t *testing.T) {
+	stacks := []*util.Stack{
+		testStack("select", "main.Map[<script>alert(1)</script>]", "main.main"),
+		testStack("select", "main.Map[<script>alert(1)</script>]", "main.main"),
+		testStack("running", "main.main"),
+	}
+
+	var buf bytes.Buffer
+	if err := (&htmlFormatter{}).formatStacks(&buf, stacks); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "<script>alert") {
+		t.Error("expected function names to be escaped")
+	}
+	if !strings.Contains(out, "main.Map[&lt;script&gt;alert(1)&lt;/script&gt;]") {
+		t.Error("expected the escaped function name in the report")
+	}
+	if n := strings.Count(out, `<details class="group">`); n != 2 {
+		t.Errorf("expected 2 groups, got %d", n)
+	}
+	if !strings.Contains(out, "<p>3 goroutines</p>") || !strings.Contains(out, "2 &times; main.Map[") {
+		t.Error("expected the goroutine and group counts")
+	}
+	if !strings.Contains(out, `<input id="search"`) {
+		t.Error("expected a search box")
+	}
+}
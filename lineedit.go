@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const maxHistory = 1000
+
+// lineEditor reads lines from the terminal with emacs style editing keys,
+// history and tab completion.
+type lineEditor struct {
+	term   *terminal
+	prompt string
+
+	history  []string
+	histFile string
+
+	// complete returns the candidates for the word ending at the end of line,
+	// along with the offset in line at which that word starts.
+	complete func(line string) (int, []string)
+}
+
+func newLineEditor(prompt string, complete func(string) (int, []string)) (*lineEditor, error) {
+	term, err := openTerminal()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &lineEditor{
+		term:     term,
+		prompt:   prompt,
+		histFile: historyFile(),
+		complete: complete,
+	}
+	e.loadHistory()
+	return e, nil
+}
+
+// historyFile picks where to persist history, $STACKPARSE_HISTORY if set and
+// ~/.stackparse_history otherwise. An empty result disables persistence.
+func historyFile() string {
+	if p, ok := os.LookupEnv("STACKPARSE_HISTORY"); ok {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".stackparse_history")
+}
+
+func (e *lineEditor) loadHistory() {
+	if e.histFile == "" {
+		return
+	}
+	fi, err := os.Open(e.histFile)
+	if err != nil {
+		return
+	}
+	defer fi.Close()
+
+	scan := bufio.NewScanner(fi)
+	for scan.Scan() {
+		if l := scan.Text(); l != "" {
+			e.history = append(e.history, l)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+
+	if e.histFile == "" {
+		return
+	}
+	fi, err := os.OpenFile(e.histFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(fi, line)
+	fi.Close()
+}
+
+func (e *lineEditor) Close() error {
+	return e.term.Close()
+}
+
+// readLine reads a single line of input. It returns io.EOF when the user
+// presses ctrl-D on an empty line.
+func (e *lineEditor) readLine() (string, error) {
+	if err := e.term.makeRaw(); err != nil {
+		return "", err
+	}
+	defer e.term.restore()
+
+	var buf []rune
+	pos := 0
+
+	// histIdx == len(history) means we're editing a fresh line, which is
+	// stashed in pending while browsing history.
+	histIdx := len(e.history)
+	var pending []rune
+
+	out := e.term.out
+	redraw := func() {
+		out.WriteString("\r" + e.prompt + string(buf) + "\x1b[K")
+		if n := len(buf) - pos; n > 0 {
+			fmt.Fprintf(out, "\x1b[%dD", n)
+		}
+		out.Flush()
+	}
+	setLine := func(l []rune) {
+		buf = append([]rune(nil), l...)
+		pos = len(buf)
+	}
+
+	redraw()
+	for {
+		k, err := e.term.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch k {
+		case keyEnter:
+			out.WriteString("\r\n")
+			out.Flush()
+			line := string(buf)
+			e.addHistory(strings.TrimSpace(line))
+			return line, nil
+		case keyCtrlC:
+			out.WriteString("^C\r\n")
+			buf, pos = nil, 0
+			histIdx = len(e.history)
+		case 4: // ctrl-D
+			if len(buf) == 0 {
+				out.WriteString("\r\n")
+				out.Flush()
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyBackspace:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case keyDelete:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyLeft, 2: // ctrl-B
+			if pos > 0 {
+				pos--
+			}
+		case keyRight, 6: // ctrl-F
+			if pos < len(buf) {
+				pos++
+			}
+		case keyHome, 1: // ctrl-A
+			pos = 0
+		case keyEnd, 5: // ctrl-E
+			pos = len(buf)
+		case 11: // ctrl-K
+			buf = buf[:pos]
+		case 21: // ctrl-U
+			buf = buf[pos:]
+			pos = 0
+		case 23: // ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case 12: // ctrl-L
+			out.WriteString("\x1b[H\x1b[2J")
+		case keyUp, 16: // ctrl-P
+			if histIdx > 0 {
+				if histIdx == len(e.history) {
+					pending = buf
+				}
+				histIdx--
+				setLine([]rune(e.history[histIdx]))
+			}
+		case keyDown, 14: // ctrl-N
+			if histIdx < len(e.history) {
+				histIdx++
+				if histIdx == len(e.history) {
+					setLine(pending)
+				} else {
+					setLine([]rune(e.history[histIdx]))
+				}
+			}
+		case '\t':
+			buf, pos = e.completeAt(buf, pos)
+		default:
+			if k >= ' ' {
+				buf = append(buf[:pos], append([]rune{k}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		redraw()
+	}
+}
+
+// completeAt runs completion for the text before the cursor. A single
+// candidate is filled in, several are narrowed to their common prefix, and if
+// that doesn't make progress they are listed below the prompt.
+func (e *lineEditor) completeAt(buf []rune, pos int) ([]rune, int) {
+	if e.complete == nil {
+		return buf, pos
+	}
+
+	before := string(buf[:pos])
+	start, cands := e.complete(before)
+	if len(cands) == 0 {
+		return buf, pos
+	}
+
+	word := before[start:]
+	var repl string
+	switch {
+	case len(cands) == 1:
+		repl = cands[0] + " "
+	default:
+		repl = commonPrefix(cands)
+		if len(repl) <= len(word) || !strings.HasPrefix(repl, word) {
+			e.listCandidates(cands)
+			return buf, pos
+		}
+	}
+
+	nbuf := []rune(before[:start] + repl)
+	npos := len(nbuf)
+	return append(nbuf, buf[pos:]...), npos
+}
+
+func (e *lineEditor) listCandidates(cands []string) {
+	const maxList = 100
+
+	out := e.term.out
+	out.WriteString("\r\n")
+	for i, c := range cands {
+		if i == maxList {
+			fmt.Fprintf(out, "... and %d more\r\n", len(cands)-maxList)
+			break
+		}
+		out.WriteString(c + "\r\n")
+	}
+}
+
+func commonPrefix(strs []string) string {
+	if len(strs) == 0 {
+		return ""
+	}
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// matchCandidates returns the sorted, deduplicated options that start with
+// word. If none do, options merely containing word are returned instead so
+// that typing part of a long package path still finds something.
+func matchCandidates(options []string, word string) []string {
+	seen := make(map[string]bool)
+	var prefixed, contains []string
+	for _, o := range options {
+		if seen[o] {
+			continue
+		}
+		seen[o] = true
+
+		if strings.HasPrefix(o, word) {
+			prefixed = append(prefixed, o)
+		} else if strings.Contains(o, word) {
+			contains = append(contains, o)
+		}
+	}
+
+	out := prefixed
+	if len(out) == 0 {
+		out = contains
+	}
+	sort.Strings(out)
+	return out
+}
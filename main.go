@@ -3,13 +3,17 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	util "github.com/whyrusleeping/stackparse/util"
@@ -30,18 +34,136 @@ To filter out goroutines from the trace, use the following flags:
   print only stacks whose state matches 'FOO'
 --state-not-match=FOO
   print only stacks whose state matches 'FOO'
+--blocked-on=REASON[,REASON...]
+  print only stacks blocked for any of the given reasons: running, mutex,
+  rwmutex-read, waitgroup, cond, chan-send, chan-recv, select, net-io, syscall,
+  sleep or other. This looks at the frames as well as the state, so a
+  semacquire in sync.(*WaitGroup).Wait is a waitgroup, not a mutex.
 
 Output is by default sorted by waittime ascending, to change this use:
---sort=[stacksize,goronum,waittime]
+--sort=[stacksize,goronum,waittime,reason]
+  reason groups goroutines by what they're blocked on and the code that blocked
 
 To print a summary of the goroutines in the stack trace, use:
 --summary
-
-If your stacks have some prefix to them (like a systemd log prefix) trim it with:
+--summary-by=[function,reason]
+  count goroutines by their top function (the default), or by what they're
+  blocked on and the innermost non-stdlib frame, e.g. 'mutex in main.(*T).get'
+
+To print the functions goroutines are in, like 'go tool pprof -top', use:
+--top or --output=top
+  flat counts goroutines with the function as their top frame, cum counts
+  goroutines with the function anywhere on their stack
+--top-count=10
+  how many functions to show, 0 for all of them
+--top-sort=[flat,cum]
+
+To print statistics for each function goroutines pass through, use:
+--framestat or --output=framestat
+  for each function the number of goroutines with it as their top frame
+  (exclusive) and anywhere on their stack (inclusive), the median and max wait
+  of those goroutines, and the distinct functions calling it
+--framestat-by=[function,line]
+  group by function, or by each file:line within a function
+--framestat-count=20
+  how many entries to show, 0 for all of them
+
+To rank groups of goroutines by how likely they are to be a leak or deadlock, use:
+--suspicious or --sus or --output=sus
+  groups are scored on their size, long waits, many goroutines blocked on the
+  same mutex or channel, nil channel waits and unusually deep stacks
+--baseline=earlier.txt
+  an earlier dump of the same process, to also flag groups that have grown;
+  defaults to the previous dump when the input holds several
+
+If the input holds several dumps, e.g. a log of a process sent SIGQUIT more than
+once, they are told apart by "SIGQUIT: quit" lines, goroutine numbers repeating
+and pauses in the timestamps of --line-prefix. To pick which to look at, use:
+--snapshot=[N,last,all]
+  the Nth dump counting from 1, the last one (the default) or all of them
+--series or --output=series
+  count goroutines by top function (or --summary-by) in every dump, most
+  changed first, to see what is growing
+
+To print the source code around each frame, use:
+--source=N
+  print N lines either side of each frame's line
+--source-user
+  only print source for frames outside the standard library
+--source-root=dir
+  look for source files under dir (may be repeated), in addition to
+  GOROOT and the module cache; files that can't be found are skipped
+
+If the logs are JSON objects, one per line, read the dump out of a field with:
+--json-field=msg
+  a dot separated path such as error.stack; the field may hold one line of the
+  dump per log line or the whole dump, and other lines are skipped
+
+If the dump is truncated or mangled, skip over the broken parts with:
+--lenient
+  goroutines that can't be fully parsed are kept as far as possible, and
+  the problems are printed to stderr
+
+Log prefixes from journald and syslog, docker, kubernetes, glog and klog, or
+that start with a timestamp are detected and trimmed automatically. For anything
+else (or if the guess is wrong) trim them with:
 --line-prefix=prefixRegex
+  use --line-prefix= to turn off the detection
+
+If the dump was built somewhere with different paths (CI, containers), use:
+--path-rewrite=/build/src=/home/me/src
+  replace a leading /build/src in frame paths with /home/me/src (may be repeated)
+--hide-runtime
+  drop frames in the runtime package, like runtime.gopark
+--collapse-stdlib
+  fold runs of standard library frames into a single line
+These apply everywhere, including JSON output, grouping and summaries.
+
+--short-paths
+  print frame locations as module@version file:line instead of the full path
+
+Output to a terminal is colored, dimming standard library and vendored frames,
+highlighting frames matching --frame-match and coloring each goroutine header
+by how long it has been waiting. Control this with:
+--color=[auto,always,never]
+
+Frame locations are hyperlinked to their code host when printing to a terminal:
+--links=[auto,always,never]
+--link-template=git.corp.com/=https://git.corp.com/{module}/src/{ref}/{file}#L{line}
+  link modules starting with git.corp.com/ using the given template, which may
+  use {module}, {version}, {ref}, {file} and {line} (may be repeated)
+--go-version=go1.16.3
+  the release to link standard library frames to (defaults to our own)
 
 To print the output in JSON format, use:
 --json or -j
+JSON output (including ndjson) can be fed back in as input, e.g.
+  stackparse --json --fm=foo dump.txt | stackparse --summary
+or select the output format explicitly with:
+--format=[default,go,json,ndjson,csv,tsv,html,markdown,template]
+  go writes stacks exactly as the Go runtime prints them, ndjson writes one JSON object per line, csv and tsv write one row per stack
+  (number, state, wait, depth, top function, created by) or summary, html
+  writes a self contained report with a searchable list of stack groups, and
+  markdown writes a report sized to paste into a GitHub issue comment
+
+To print each stack (or summary, with --summary) using a Go text/template:
+--template='{{.Number}} {{.State}} {{(index .Frames 0).Function}}'
+--template-file=report.tmpl
+  besides the builtins, templates can use topFrame and topUserFrame (the
+  innermost frame, and innermost outside the standard library, of a stack),
+  shortFunc (a function name without its import path), duration (e.g. 25m),
+  location and package (of a frame) and join
+
+To browse the goroutines interactively, use:
+--repl
+  a line based prompt for narrowing down the set of goroutines, with tab
+  completion and history saved to ~/.stackparse_history (or $STACKPARSE_HISTORY)
+--tui
+  a full screen terminal browser of goroutine groups
+
+To replay REPL commands non-interactively (e.g. a file saved with 'record'), use:
+--script=file
+  combine with --repl to keep investigating once the script has run
 `
 	fmt.Println(helpstr)
 }
@@ -59,14 +181,31 @@ func main() {
 	formatType := "default"
 	fname := "-"
 
-	var linePrefix string
+	parseOpts := util.ParseOptions{DetectPrefix: true}
 
 	var repl bool
+	var tui bool
+	var script string
+	var hideRuntime, collapseStdlib bool
+	var tmpl *template.Template
+	summaryBy := "function"
+	top := topOptions{count: 10, sortBy: "flat"}
+	frameStat := frameStatOptions{by: "function", count: 20}
+	var sus susOptions
+	var baseline string
+	var snapshot string
+
+	printer := &stackPrinter{
+		linker: &util.Linker{GoVersion: defaultGoVersion()},
+		links:  "auto",
+		color:  "auto",
+	}
+	var sourceRoots []string
 
 	// parse flags
 	for _, a := range os.Args[1:] {
 		if strings.HasPrefix(a, "-") {
-			parts := strings.Split(a, "=")
+			parts := strings.SplitN(a, "=", 2)
 			var key string
 			var val string
 			key = parts[0]
@@ -74,62 +213,157 @@ func main() {
 				val = parts[1]
 			}
 
-			switch key {
-			case "--frame-match", "--fm":
-				filters = append(filters, util.HasFrameMatching(val))
-			case "--wait-more-than":
-				d, err := time.ParseDuration(val)
+			if filt, ok, err := parseFilter(key, val); ok {
 				if err != nil {
 					fmt.Println(err)
 					os.Exit(1)
 				}
-				filters = append(filters, util.TimeGreaterThan(d))
-			case "--wait-less-than":
-				d, err := time.ParseDuration(val)
+				filters = append(filters, filt)
+				if key == "--frame-match" || key == "--fm" {
+					printer.highlight = append(printer.highlight, val)
+				}
+				continue
+			}
+
+			switch key {
+			case "--sort":
+				cf, err := parseSort(val)
 				if err != nil {
 					fmt.Println(err)
 					os.Exit(1)
 				}
-				filters = append(filters, util.Negate(util.TimeGreaterThan(d)))
-			case "--frame-not-match", "--fnm":
-				filters = append(filters, util.Negate(util.HasFrameMatching(val)))
-			case "--state-match":
-				filters = append(filters, util.MatchState(val))
-			case "--state-not-match":
-				filters = append(filters, util.Negate(util.MatchState(val)))
-			case "--sort":
-				switch parts[1] {
-				case "goronum":
-					compfunc = util.CompGoroNum
-				case "stacksize":
-					compfunc = util.CompDepth
-				case "waittime":
-					compfunc = util.CompWaitTime
-				default:
-					fmt.Println("unknown sorting parameter: ", val)
-					fmt.Println("options: goronum, stacksize, waittime (default)")
+				compfunc = cf
+			case "--json-field":
+				if val == "" {
+					fmt.Println("--json-field needs a field path, e.g. --json-field=msg")
 					os.Exit(1)
 				}
+				parseOpts.JSONField = val
+			case "--lenient":
+				parseOpts.Lenient = true
 			case "--line-prefix":
-				linePrefix = val
+				parseOpts.LinePrefix = val
+				parseOpts.DetectPrefix = false
+			case "--path-rewrite":
+				rw, err := util.ParsePathRewrite(val)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				parseOpts.PathRewrites = append(parseOpts.PathRewrites, rw)
+			case "--hide-runtime":
+				hideRuntime = true
+			case "--collapse-stdlib":
+				collapseStdlib = true
+			case "--short-paths":
+				printer.shortPaths = true
+			case "--color", "--colour":
+				if err := checkEscapeMode(val); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				printer.color = val
+			case "--links":
+				if err := checkEscapeMode(val); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				printer.links = val
+			case "--link-template":
+				lt, err := util.ParseLinkTemplate(val)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				printer.linker.Templates = append(printer.linker.Templates, lt)
+			case "--go-version":
+				printer.linker.GoVersion = val
+			case "--source":
+				n, err := strconv.Atoi(val)
+				if err != nil {
+					fmt.Println("invalid number of source lines: ", val)
+					os.Exit(1)
+				}
+				printer.contextLines = n
+			case "--source-user":
+				printer.userOnly = true
+			case "--source-root":
+				sourceRoots = append(sourceRoots, filepath.SplitList(val)...)
 
 			case "--repl":
 				repl = true
+			case "--tui":
+				tui = true
+			case "--script":
+				script = val
 			case "--output":
-				switch val {
-				case "full", "top", "summary":
-					outputType = val
-				default:
-					fmt.Println("unrecognized output type: ", parts[1])
-					fmt.Println("valid options are: full, top, summary, json")
+				if err := checkOutputType(val); err != nil {
+					fmt.Println(err)
 					os.Exit(1)
 				}
+				outputType = val
 			case "--summary", "-s":
 				outputType = "summary"
+			case "--summary-by":
+				if _, err := checkSummaryBy(val); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				summaryBy = val
+			case "--top":
+				outputType = "top"
+			case "--top-count":
+				n, err := strconv.Atoi(val)
+				if err != nil {
+					fmt.Println("invalid top count: ", val)
+					os.Exit(1)
+				}
+				top.count = n
+			case "--top-sort":
+				if err := checkTopSort(val); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				top.sortBy = val
+			case "--framestat":
+				outputType = "framestat"
+			case "--framestat-by":
+				if err := checkFrameStatBy(val); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				frameStat.by = val
+			case "--framestat-count":
+				n, err := strconv.Atoi(val)
+				if err != nil {
+					fmt.Println("invalid framestat count: ", val)
+					os.Exit(1)
+				}
+				frameStat.count = n
 			case "--json", "-j":
 				formatType = "json"
+			case "--format":
+				formatType = val
+			case "--template", "--template-file":
+				t, err := parseTemplate(val, key == "--template-file")
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				tmpl = t
+				formatType = "template"
 			case "--suspicious", "--sus":
 				outputType = "sus"
+			case "--baseline":
+				baseline = val
+			case "--snapshot":
+				if err := checkSnapshot(val); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				snapshot = val
+			case "--series":
+				outputType = "series"
 			}
 		} else {
 			fname = a
@@ -150,11 +384,64 @@ func main() {
 		r = fi
 	}
 
-	stacks, err := util.ParseStacks(r, linePrefix)
+	// look for a log prefix here rather than leaving it to the parser, to
+	// be able to say which one was found
+	inputOpts := parseOpts
+	if parseOpts.JSONField != "" {
+		r = util.NewJSONFieldReader(r, parseOpts.JSONField)
+		inputOpts.JSONField = ""
+	}
+	if parseOpts.DetectPrefix {
+		br := bufio.NewReaderSize(r, util.PrefixSampleSize)
+		if pf, ok := util.DetectLinePrefix(br); ok {
+			fmt.Fprintf(os.Stderr, "note: trimming %s log prefixes, override with --line-prefix\n", pf.Name)
+			inputOpts.LinePrefix = pf.Pattern
+		}
+		inputOpts.DetectPrefix = false
+		r = br
+	}
+
+	snaps, err := parseSnapshots(r, inputOpts)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	simplify := func(stacks []*util.Stack) {
+		for i, s := range stacks {
+			if hideRuntime {
+				s = s.HideRuntime()
+			}
+			if collapseStdlib {
+				s = s.CollapseStdlib()
+			}
+			stacks[i] = s
+		}
+	}
+	for _, snap := range snaps {
+		simplify(snap.Stacks)
+	}
+
+	stacks, idx, err := selectSnapshot(snaps, snapshot)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	if snapshot == "" && len(snaps) > 1 && outputType != "series" {
+		fmt.Fprintf(os.Stderr, "note: input holds %d dumps, showing the last; pick another with --snapshot=N, or use --snapshot=all\n", len(snaps))
+	}
+
+	if baseline != "" {
+		sus.baseline, err = readStackFile(baseline, parseOpts)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		simplify(sus.baseline)
+	} else if idx > 0 {
+		// compare against the dump before this one
+		sus.baseline = snaps[idx-1].Stacks
+	}
 
 	sorter := util.StackSorter{
 		Stacks:   stacks,
@@ -163,37 +450,313 @@ func main() {
 
 	sort.Sort(sorter)
 
-	var f formatter
+	if len(sourceRoots) > 0 || printer.contextLines > 0 {
+		printer.source = util.NewSourceResolver(sourceRoots)
+	}
+
+	fmtConfig := &formatConfig{
+		printer:   printer,
+		template:  tmpl,
+		summaryBy: summaryBy,
+		top:       top,
+		frameStat: frameStat,
+		sus:       sus,
+	}
+
+	f, err := newFormatter(formatType, fmtConfig)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	stacks = util.ApplyFilters(stacks, filters)
+	for _, snap := range snaps {
+		fmtConfig.snapshots = append(fmtConfig.snapshots, &util.Snapshot{
+			Line:   snap.Line,
+			Time:   snap.Time,
+			Stacks: util.ApplyFilters(snap.Stacks, filters),
+		})
+	}
+
+	if tui {
+		if err := runTui(stacks, printer); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if script == "" {
+		if err := writeOutput(os.Stdout, f, fmtConfig, outputType, stacks); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if script != "" || repl {
+		r := newReplState(stacks, compfunc, formatType, outputType, fmtConfig)
+		r.interactive = repl
+		if script != "" {
+			if err := r.runScript(script); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		if repl {
+			r.run()
+		}
+	}
+}
+
+// readStackFile parses the stacks in the named file, taking the last dump
+// if it holds several.
+func readStackFile(fname string, opts util.ParseOptions) ([]*util.Stack, error) {
+	fi, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	snaps, err := parseSnapshots(fi, opts)
+	if err != nil {
+		return nil, err
+	}
+	stacks, _, err := selectSnapshot(snaps, "last")
+	return stacks, err
+}
+
+func checkSnapshot(val string) error {
+	switch val {
+	case "last", "all":
+		return nil
+	}
+	if n, err := strconv.Atoi(val); err != nil || n < 1 {
+		return fmt.Errorf("invalid snapshot: %q\nvalid options are: last, all or a dump number starting from 1", val)
+	}
+	return nil
+}
+
+// selectSnapshot picks the stacks of the dump chosen by --snapshot, and
+// returns its index, or -1 if all of them were chosen.
+func selectSnapshot(snaps []*util.Snapshot, val string) ([]*util.Stack, int, error) {
+	if len(snaps) == 0 {
+		return nil, -1, nil
+	}
+
+	switch val {
+	case "", "last":
+		return snaps[len(snaps)-1].Stacks, len(snaps) - 1, nil
+	case "all":
+		var stacks []*util.Stack
+		for _, snap := range snaps {
+			stacks = append(stacks, snap.Stacks...)
+		}
+		return stacks, -1, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 || n > len(snaps) {
+		return nil, -1, fmt.Errorf("no snapshot %s, the input holds %d dumps", val, len(snaps))
+	}
+	return snaps[n-1].Stacks, n - 1, nil
+}
+
+// maxWarnings is how many parse problems are printed individually in
+// lenient mode before just counting the rest.
+const maxWarnings = 10
+
+// parseSnapshots parses the dumps in the input, printing any problems
+// skipped over in lenient mode to stderr.
+func parseSnapshots(r io.Reader, opts util.ParseOptions) ([]*util.Snapshot, error) {
+	snaps, diags, err := util.ParseSnapshots(r, opts)
+	var perr *util.ParseError
+	if errors.As(err, &perr) {
+		parsed := 0
+		for _, snap := range snaps {
+			parsed += len(snap.Stacks)
+		}
+		return nil, fmt.Errorf("%s\n%d goroutines parsed before the error, use --lenient to skip over problems", err, parsed)
+	} else if errors.Is(err, util.ErrNotStackJSON) {
+		return nil, fmt.Errorf("%s, use --json-field to read a dump out of JSON logs", err)
+	} else if err != nil {
+		return nil, err
+	}
+	if len(diags) == 0 {
+		return snaps, nil
+	}
+
+	affected := make(map[int]bool)
+	for i, d := range diags {
+		if i < maxWarnings {
+			fmt.Fprintln(os.Stderr, "warning:", d)
+		}
+		if d.Goroutine >= 0 {
+			affected[d.Goroutine] = true
+		}
+	}
+	if len(diags) > maxWarnings {
+		fmt.Fprintf(os.Stderr, "warning: ... and %d more\n", len(diags)-maxWarnings)
+	}
+	fmt.Fprintf(os.Stderr, "warning: %d problems parsing input, %d goroutines partially recovered\n", len(diags), len(affected))
+	return snaps, nil
+}
+
+// parseFilter builds the filter described by a filter flag such as
+// --frame-match=FOO. The second return value is false if key is not a
+// filter flag at all.
+func parseFilter(key, val string) (util.Filter, bool, error) {
+	switch key {
+	case "--frame-match", "--fm":
+		return util.HasFrameMatching(val), true, nil
+	case "--frame-not-match", "--fnm":
+		return util.Negate(util.HasFrameMatching(val)), true, nil
+	case "--wait-more-than":
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, true, err
+		}
+		return util.TimeGreaterThan(d), true, nil
+	case "--wait-less-than":
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, true, err
+		}
+		return util.Negate(util.TimeGreaterThan(d)), true, nil
+	case "--state-match":
+		return util.MatchState(val), true, nil
+	case "--state-not-match":
+		return util.Negate(util.MatchState(val)), true, nil
+	case "--blocked-on":
+		reasons := strings.Split(val, ",")
+		for _, r := range reasons {
+			if !util.IsBlockReason(r) {
+				return nil, true, fmt.Errorf("unknown blocking reason: %q\noptions: %s", r, strings.Join(util.BlockReasons, ", "))
+			}
+		}
+		return util.MatchBlockReason(reasons...), true, nil
+	}
+	return nil, false, nil
+}
+
+func parseSort(val string) (util.StackCompFunc, error) {
+	switch val {
+	case "goronum":
+		return util.CompGoroNum, nil
+	case "stacksize":
+		return util.CompDepth, nil
+	case "waittime":
+		return util.CompWaitTime, nil
+	case "reason":
+		return util.CompBlockReason, nil
+	default:
+		return nil, fmt.Errorf("unknown sorting parameter: %q\noptions: goronum, stacksize, waittime (default), reason", val)
+	}
+}
+
+// formatConfig holds the settings the formatters need beyond their type.
+type formatConfig struct {
+	printer   *stackPrinter
+	template  *template.Template
+	summaryBy string
+	top       topOptions
+	frameStat frameStatOptions
+	sus       susOptions
+
+	// snapshots are all the dumps in the input, for the series output
+	snapshots []*util.Snapshot
+}
+
+func newFormatter(formatType string, cfg *formatConfig) (formatter, error) {
 	switch formatType {
 	case "default":
-		f = &defaultFormatter{}
+		return &defaultFormatter{printer: cfg.printer}, nil
 	case "json":
-		f = &jsonFormatter{}
+		return &jsonFormatter{}, nil
+	case "go", "traceback":
+		return &tracebackFormatter{}, nil
+	case "ndjson":
+		return &ndjsonFormatter{}, nil
+	case "csv":
+		return &csvFormatter{}, nil
+	case "tsv":
+		return &csvFormatter{comma: '\t'}, nil
+	case "html":
+		return &htmlFormatter{linker: cfg.printer.linker}, nil
+	case "markdown", "md":
+		return &markdownFormatter{linker: cfg.printer.linker}, nil
+	case "template":
+		if cfg.template == nil {
+			return nil, fmt.Errorf("no template given, use --template or --template-file")
+		}
+		return &templateFormatter{tmpl: cfg.template}, nil
+	default:
+		return nil, fmt.Errorf("unrecognized format: %q\nvalid options are: default, go, json, ndjson, csv, tsv, html, markdown, template", formatType)
 	}
+}
 
-	stacks = util.ApplyFilters(stacks, filters)
+func checkEscapeMode(mode string) error {
+	switch mode {
+	case "auto", "always", "never":
+		return nil
+	default:
+		return fmt.Errorf("unrecognized mode: %q\nvalid options are: auto, always, never", mode)
+	}
+}
+
+// defaultGoVersion guesses the release tag to link standard library frames
+// to. We can't know what the dump was built with, so use our own version.
+func defaultGoVersion() string {
+	v := runtime.Version()
+	if !strings.HasPrefix(v, "go") || strings.Contains(v, " ") {
+		return "master"
+	}
+	return v
+}
 
-	var formatErr error
+func checkOutputType(outputType string) error {
+	switch outputType {
+	case "full", "top", "summary", "sus", "framestat", "series":
+		return nil
+	default:
+		return fmt.Errorf("unrecognized output type: %q\nvalid options are: full, top, summary, sus, framestat, series", outputType)
+	}
+}
 
+// writeOutput renders stacks to w in the given output mode. Every formatter
+// prints stacks and summaries, the other modes only where the formatter also
+// implements that mode's interface, such as topFormatter.
+func writeOutput(w io.Writer, f formatter, cfg *formatConfig, outputType string, stacks []*util.Stack) error {
 	switch outputType {
 	case "full":
-		formatErr = f.formatStacks(os.Stdout, stacks)
+		return f.formatStacks(w, stacks)
 	case "summary":
-		formatErr = f.formatSummaries(os.Stdout, summarize(stacks))
+		return f.formatSummaries(w, summarizeBy(stacks, summaryKey(cfg.summaryBy)))
+	case "top":
+		tf, ok := f.(topFormatter)
+		if !ok {
+			return fmt.Errorf("top output is not supported by this format")
+		}
+		return tf.formatTop(w, computeTop(stacks, cfg.top), len(stacks))
+	case "framestat":
+		ff, ok := f.(frameStatFormatter)
+		if !ok {
+			return fmt.Errorf("framestat output is not supported by this format")
+		}
+		return ff.formatFrameStats(w, computeFrameStats(stacks, cfg.frameStat))
+	case "series":
+		sf, ok := f.(seriesFormatter)
+		if !ok {
+			return fmt.Errorf("series output is not supported by this format")
+		}
+		return sf.formatSeries(w, computeSeries(cfg.snapshots, summaryKey(cfg.summaryBy)))
 	case "sus":
-		suspiciousCheck(util.ApplyFilters(stacks, filters))
+		sf, ok := f.(susFormatter)
+		if !ok {
+			return fmt.Errorf("sus output is not supported by this format")
+		}
+		return sf.formatFindings(w, findSuspicious(stacks, cfg.sus))
 	default:
-		fmt.Println("unrecognized output type: ", outputType)
-		os.Exit(1)
-	}
-
-	if formatErr != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	if repl {
-		runRepl(util.ApplyFilters(stacks, filters))
+		return fmt.Errorf("unrecognized output type: %s", outputType)
 	}
 }
 
@@ -207,7 +770,9 @@ type formatter interface {
 	formatStacks(io.Writer, []*util.Stack) error
 }
 
-type defaultFormatter struct{}
+type defaultFormatter struct {
+	printer *stackPrinter
+}
 
 func (t *defaultFormatter) formatSummaries(w io.Writer, summaries []summary) error {
 	tw := tabwriter.NewWriter(w, 8, 4, 2, ' ', 0)
@@ -220,11 +785,24 @@ func (t *defaultFormatter) formatSummaries(w io.Writer, summaries []summary) err
 
 func (t *defaultFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
 	for _, s := range stacks {
-		fmt.Fprintln(w, s.String())
+		if err := t.printer.writeStack(w, s); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
 	}
 	return nil
 }
 
+// tracebackFormatter writes stacks in the runtime's own format, so filtered
+// output can be fed to other tools that read goroutine dumps.
+type tracebackFormatter struct {
+	defaultFormatter
+}
+
+func (t *tracebackFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
+	return util.WriteTracebacks(w, stacks)
+}
+
 type jsonFormatter struct{}
 
 func (j *jsonFormatter) formatSummaries(w io.Writer, summaries []summary) error {
@@ -236,12 +814,18 @@ func (j *jsonFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
 }
 
 func summarize(stacks []*util.Stack) []summary {
+	return summarizeBy(stacks, topFunctionKey)
+}
+
+// summarizeBy counts stacks by the given key, which is reported in the
+// Function field of each summary.
+func summarizeBy(stacks []*util.Stack, key func(*util.Stack) string) []summary {
 	counts := make(map[string]int)
 
 	var filtered []*util.Stack
 
 	for _, s := range stacks {
-		f := s.Frames[0].Function
+		f := key(s)
 		if counts[f] == 0 {
 			filtered = append(filtered, s)
 		}
@@ -251,84 +835,95 @@ func summarize(stacks []*util.Stack) []summary {
 	sort.Sort(util.StackSorter{
 		Stacks: filtered,
 		CompFunc: func(a, b *util.Stack) bool {
-			return counts[a.Frames[0].Function] < counts[b.Frames[0].Function]
+			return counts[key(a)] < counts[key(b)]
 		},
 	})
 
 	var summaries []summary
 	for _, s := range filtered {
 		summaries = append(summaries, summary{
-			Function: s.Frames[0].Function,
-			Count:    counts[s.Frames[0].Function],
+			Function: key(s),
+			Count:    counts[key(s)],
 		})
 	}
 	return summaries
 }
 
-type framecount struct {
-	frameKey string
-	count    int
-}
-
-// work in progress, trying to come up with an algorithm to point out suspicious stacks
-func suspiciousCheck(stacks []*util.Stack) {
-	sharedFrames := make(map[string][]*util.Stack)
-
-	for _, s := range stacks {
-		for _, f := range s.Frames {
-			fk := f.FrameKey()
-			sharedFrames[fk] = append(sharedFrames[fk], s)
-		}
+// summaryKey returns the key to summarize stacks by for a --summary-by
+// value, defaulting to the top function.
+func summaryKey(by string) func(*util.Stack) string {
+	if key, err := checkSummaryBy(by); err == nil {
+		return key
 	}
+	return topFunctionKey
+}
 
-	var fcs []framecount
-	for k, v := range sharedFrames {
-		fcs = append(fcs, framecount{
-			frameKey: k,
-			count:    len(v),
-		})
+func checkSummaryBy(by string) (func(*util.Stack) string, error) {
+	switch by {
+	case "", "function":
+		return topFunctionKey, nil
+	case "reason":
+		return blockingKey, nil
+	default:
+		return nil, fmt.Errorf("unrecognized summary key: %q\nvalid options are: function, reason", by)
 	}
+}
 
-	sort.Slice(fcs, func(i, j int) bool {
-		return fcs[i].count > fcs[j].count
-	})
+// stackGroup is a set of stacks that share a grouping key, along with a
+// representative stack to display for the whole group.
+type stackGroup struct {
+	Key    string
+	Rep    *util.Stack
+	Stacks []*util.Stack
+}
 
-	for i := 0; i < 20; i++ {
-		fmt.Printf("%s - %d\n", fcs[i].frameKey, fcs[i].count)
+// uniqueKey groups stacks the same way util.Stack.Sameish compares them.
+func uniqueKey(s *util.Stack) string {
+	funcs := make([]string, 0, len(s.Frames))
+	for _, f := range s.Frames {
+		funcs = append(funcs, f.Function)
 	}
+	return strings.Join(funcs, "\n")
+}
 
-	for i := 0; i < 5; i++ {
-		fmt.Println("-------- FRAME SUS STAT ------")
-		fmt.Printf("%s - %d\n", fcs[i].frameKey, fcs[i].count)
-
-		sf := sharedFrames[fcs[i].frameKey]
-
-		printUnique(sf)
+// topFunctionKey groups stacks by the function in their top frame, which is
+// what summarize counts.
+func topFunctionKey(s *util.Stack) string {
+	if len(s.Frames) == 0 {
+		return ""
 	}
+	return s.Frames[0].Function
 }
 
-func printUnique(stacks []*util.Stack) {
-	var ftypes []*util.Stack
-	var bucketed [][]*util.Stack
-	for _, s := range stacks {
-		var found bool
-		for x, ft := range ftypes {
-			if s.Sameish(ft) {
-				bucketed[x] = append(bucketed[x], s)
-				found = true
-			}
-		}
+// blockingKey groups stacks by what they're blocked on and the user code
+// that blocked, see util.Stack.Blocking.
+func blockingKey(s *util.Stack) string {
+	return s.Blocking().Key()
+}
 
-		if !found {
-			ftypes = append(ftypes, s)
-			bucketed = append(bucketed, []*util.Stack{s})
+// groupStacks buckets stacks by the given key, preserving the order in which
+// each key was first seen.
+func groupStacks(stacks []*util.Stack, key func(*util.Stack) string) []*stackGroup {
+	index := make(map[string]*stackGroup)
+	var groups []*stackGroup
+	for _, s := range stacks {
+		k := key(s)
+		g, ok := index[k]
+		if !ok {
+			g = &stackGroup{Key: k, Rep: s}
+			index[k] = g
+			groups = append(groups, g)
 		}
+		g.Stacks = append(g.Stacks, s)
 	}
+	return groups
+}
 
-	for x, ft := range ftypes {
-		fmt.Println("count: ", len(bucketed[x]))
-		fmt.Println("average wait: ", compWaitStats(bucketed[x]).String())
-		fmt.Println(ft.String())
+func printUnique(stacks []*util.Stack) {
+	for _, g := range groupStacks(stacks, uniqueKey) {
+		fmt.Println("count: ", len(g.Stacks))
+		fmt.Println("average wait: ", compWaitStats(g.Stacks).String())
+		fmt.Println(g.Rep.String())
 		fmt.Println()
 	}
 }
@@ -370,118 +965,3 @@ func compWaitStats(stacks []*util.Stack) waitStats {
 		Median:  durations[len(durations)/2],
 	}
 }
-
-func frameStat(stacks []*util.Stack) {
-	frames := make(map[string]int)
-
-	for _, s := range stacks {
-		for _, f := range s.Frames {
-			frames[fmt.Sprintf("%s:%d\n%s", f.File, f.Line, f.Function)]++
-		}
-	}
-
-	type frameCount struct {
-		Line  string
-		Count int
-	}
-
-	var fcs []frameCount
-	for k, v := range frames {
-		fcs = append(fcs, frameCount{
-			Line:  k,
-			Count: v,
-		})
-	}
-
-	sort.Slice(fcs, func(i, j int) bool {
-		return fcs[i].Count < fcs[j].Count
-	})
-
-	for _, fc := range fcs {
-		fmt.Printf("%s\t%d\n", fc.Line, fc.Count)
-	}
-}
-
-func runRepl(input []*util.Stack) {
-	bynumber := make(map[int]*util.Stack)
-	for _, i := range input {
-		bynumber[i.Number] = i
-	}
-
-	stk := [][]*util.Stack{input}
-	ops := []string{"."}
-
-	cur := input
-
-	f := &defaultFormatter{}
-
-	scan := bufio.NewScanner(os.Stdin)
-	fmt.Print("stackparse> ")
-	for scan.Scan() {
-		parts := strings.Split(scan.Text(), " ")
-		switch parts[0] {
-		case "fm", "frame-match":
-
-			var filters []util.Filter
-			for _, p := range parts[1:] {
-				filters = append(filters, util.HasFrameMatching(strings.TrimSpace(p)))
-			}
-
-			cur = util.ApplyFilters(cur, filters)
-			stk = append(stk, cur)
-			ops = append(ops, scan.Text())
-
-		case "fnm", "frame-not-match":
-			var filters []util.Filter
-			for _, p := range parts[1:] {
-				filters = append(filters, util.Negate(util.HasFrameMatching(strings.TrimSpace(p))))
-			}
-
-			cur = util.ApplyFilters(cur, filters)
-			stk = append(stk, cur)
-			ops = append(ops, scan.Text())
-		case "s", "summary", "sum":
-			err := f.formatSummaries(os.Stdout, summarize(cur))
-			if err != nil {
-				fmt.Println(err)
-			}
-		case "show", "p", "print":
-			if len(parts) > 1 {
-				num, err := strconv.Atoi(parts[1])
-				if err != nil {
-					fmt.Println(err)
-					goto end
-				}
-				s, ok := bynumber[num]
-				if !ok {
-					fmt.Println("no stack found with that number")
-					goto end
-				}
-				f.formatStacks(os.Stdout, []*util.Stack{s})
-			} else {
-				f.formatStacks(os.Stdout, cur)
-			}
-		case "diff":
-			for i, op := range ops {
-				fmt.Printf("%d (%d): %s\n", i, len(stk[i]), op)
-			}
-		case "pop":
-			if len(stk) > 1 {
-				stk = stk[:len(stk)-1]
-				ops = ops[:len(ops)-1]
-
-				cur = stk[len(stk)-1]
-			}
-		case "sus":
-			// WIP!!!
-			suspiciousCheck(cur)
-		case "framestat":
-			frameStat(cur)
-		case "unique", "uu":
-			printUnique(cur)
-		}
-
-	end:
-		fmt.Print("stackparse> ")
-	}
-}
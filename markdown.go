@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// maxMarkdownLen keeps reports under GitHub's 65536 character limit for
+// issue comments, with some room to spare for a few words around them.
+const maxMarkdownLen = 60000
+
+// maxMarkdownSummaries caps the summary table so it doesn't crowd out the
+// groups themselves.
+const maxMarkdownSummaries = 50
+
+// markdownFormatter writes a report to paste into an issue tracker, dropping
+// the smallest groups if it would otherwise be too long.
+type markdownFormatter struct {
+	linker *util.Linker
+}
+
+func (m *markdownFormatter) summaryTable(summaries []summary, maxRows int) string {
+	// summarize sorts ascending, but the biggest counts matter most here
+	sorted := append([]summary(nil), summaries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Count > sorted[j].Count
+	})
+
+	sb := strings.Builder{}
+	sb.WriteString("| count | top function |\n| ---: | --- |\n")
+	for i, s := range sorted {
+		if i == maxRows {
+			rest := 0
+			for _, r := range sorted[i:] {
+				rest += r.Count
+			}
+			sb.WriteString(fmt.Sprintf("| %d | _%d more functions_ |\n", rest, len(sorted)-i))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("| %d | `%s` |\n", s.Count, s.Function))
+	}
+	return sb.String()
+}
+
+func (m *markdownFormatter) formatSummaries(w io.Writer, summaries []summary) error {
+	// each row is short, so this is plenty to stay under the limit
+	_, err := io.WriteString(w, m.summaryTable(summaries, maxMarkdownLen/200))
+	return err
+}
+
+func (m *markdownFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("**%d goroutines**\n\n", len(stacks)))
+	sb.WriteString(m.summaryTable(summarize(stacks), maxMarkdownSummaries))
+	sb.WriteString("\n")
+
+	groups := groupStacks(stacks, uniqueKey)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Stacks) > len(groups[j].Stacks)
+	})
+
+	omitted := func(rest []*stackGroup) string {
+		n := 0
+		for _, g := range rest {
+			n += len(g.Stacks)
+		}
+		return fmt.Sprintf("_%d more groups (%d goroutines) omitted to fit the comment length limit_\n", len(rest), n)
+	}
+	// leave room for the note, which is longest if every group is omitted
+	reserve := len(omitted(groups))
+
+	for i, g := range groups {
+		section := m.group(g)
+		if sb.Len()+len(section)+reserve > maxMarkdownLen {
+			sb.WriteString(omitted(groups[i:]))
+			break
+		}
+		sb.WriteString(section)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (m *markdownFormatter) group(g *stackGroup) string {
+	ws := compWaitStats(g.Stacks)
+
+	var states []string
+	for _, c := range countBy(g.Stacks, func(s *util.Stack) string { return s.State }) {
+		states = append(states, fmt.Sprintf("%s: %d", c.Name, c.Count))
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("<details>\n")
+	sb.WriteString(fmt.Sprintf("<summary>%d &times; <code>%s</code> [%s] wait av/max: %s/%s</summary>\n\n",
+		len(g.Stacks), topFunctionKey(g.Rep), strings.Join(states, ", "),
+		formatDuration(ws.Average), formatDuration(ws.Max)))
+	sb.WriteString("```\n")
+	sb.WriteString(g.Rep.String())
+	sb.WriteString("```\n")
+
+	if m.linker != nil {
+		var links []string
+		for i := range g.Rep.Frames {
+			f := &g.Rep.Frames[i]
+			if f.IsStdlib() {
+				continue
+			}
+			if url := m.linker.URL(f); url != "" {
+				links = append(links, fmt.Sprintf("[`%s`](%s)", shortFunc(f.Function), url))
+			}
+		}
+		if len(links) > 0 {
+			sb.WriteString("\nSource: " + strings.Join(links, ", ") + "\n")
+		}
+	}
+
+	sb.WriteString("\n</details>\n\n")
+	return sb.String()
+}
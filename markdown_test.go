@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+func TestMarkdownLength(t *testing.T) {
+	var stacks []*util.Stack
+	for i := 0; i < 500; i++ {
+		frames := []string{fmt.Sprintf("main.group%d", i)}
+		for j := 0; j < 30; j++ {
+			frames = append(frames, fmt.Sprintf("github.com/example/project/internal/pkg%d.(*handler).serveRequest%d", j, j))
+		}
+		stacks = append(stacks, testStack("select", frames...))
+	}
+
+	var buf bytes.Buffer
+	m := &markdownFormatter{}
+	if err := m.formatStacks(&buf, stacks); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if len(out) > maxMarkdownLen {
+		t.Errorf("expected at most %d characters, got %d", maxMarkdownLen, len(out))
+	}
+	if !strings.Contains(out, "more groups (") || !strings.HasSuffix(out, "omitted to fit the comment length limit_\n") {
+		t.Errorf("expected a note about the omitted groups at the end, got:\n%s", out[len(out)-200:])
+	}
+
+	// small reports are left alone
+	buf.Reset()
+	if err := m.formatStacks(&buf, stacks[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "omitted") || strings.Count(buf.String(), "<details>") != 3 {
+		t.Errorf("expected all 3 groups, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// stackPrinter renders stacks in the default text format, with optional
+// extras such as the source code around each frame.
+type stackPrinter struct {
+	// source, if set, is used to print contextLines lines of source either
+	// side of each frame, or only of user code frames if userOnly is set.
+	source       *util.SourceResolver
+	contextLines int
+	userOnly     bool
+
+	// shortPaths prints frame locations without their build root, see
+	// util.Frame.Location.
+	shortPaths bool
+
+	// linker, if set, turns frame locations into terminal hyperlinks when
+	// links is "always", or "auto" and we're writing to a terminal.
+	linker *util.Linker
+	links  string
+
+	// color is auto, always or never. Colored output dims stdlib and
+	// vendored frames, highlights frames containing any of highlight and
+	// colors the goroutine header by how worrying its state is.
+	color     string
+	highlight []string
+}
+
+// ANSI SGR sequences used for colored output.
+const (
+	sgrReset  = "\x1b[0m"
+	sgrBold   = "\x1b[1m"
+	sgrDim    = "\x1b[2m"
+	sgrRed    = "\x1b[1;31m"
+	sgrGreen  = "\x1b[32m"
+	sgrYellow = "\x1b[33m"
+	sgrMatch  = "\x1b[1;36m"
+)
+
+// renderOpts says which escape sequences the output can contain.
+type renderOpts struct {
+	links bool
+	color bool
+}
+
+// isTerminal reports whether w is a terminal rather than a file or pipe.
+func isTerminal(w io.Writer) bool {
+	fi, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	st, err := fi.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// useEscapes resolves an auto/always/never setting for output going to w.
+func useEscapes(mode string, w io.Writer) bool {
+	switch mode {
+	case "always":
+		return true
+	case "auto":
+		// https://no-color.org
+		if _, ok := os.LookupEnv("NO_COLOR"); ok {
+			return false
+		}
+		return isTerminal(w)
+	default:
+		return false
+	}
+}
+
+// stackString renders s without any terminal escape sequences.
+func (p *stackPrinter) stackString(s *util.Stack) string {
+	return p.render(s, renderOpts{})
+}
+
+// writeStack renders s to w, using escape sequences if w can display them.
+func (p *stackPrinter) writeStack(w io.Writer, s *util.Stack) error {
+	var opts renderOpts
+	if p != nil {
+		opts.links = p.linker != nil && useEscapes(p.links, w)
+		opts.color = useEscapes(p.color, w)
+	}
+	_, err := io.WriteString(w, p.render(s, opts))
+	return err
+}
+
+func (p *stackPrinter) render(s *util.Stack, opts renderOpts) string {
+	if p == nil || (p.source == nil && !p.shortPaths && !opts.links && !opts.color) {
+		return s.String()
+	}
+
+	sb := strings.Builder{}
+	if opts.color {
+		sb.WriteString(headerColor(s) + s.Header() + sgrReset)
+	} else {
+		sb.WriteString(s.Header())
+	}
+	sb.WriteRune('\n')
+	for i := range s.Frames {
+		f := &s.Frames[i]
+		if m := s.ElidedMarker(i); m != "" {
+			sb.WriteString(m + "\n")
+		}
+		p.writeFrame(&sb, f, opts)
+		if p.source != nil {
+			p.writeSource(&sb, f)
+		}
+	}
+	if s.FramesElided {
+		sb.WriteString("...additional frames elided...\n")
+	}
+	if s.CreatedBy.Function != "" {
+		sb.WriteString(s.CreatedBy.String())
+		sb.WriteRune('\n')
+	}
+	return sb.String()
+}
+
+// headerColor picks a color for the goroutine header by severity: long
+// waits and goroutines that can never wake are red, other waits yellow and
+// goroutines that are doing something green.
+func headerColor(s *util.Stack) string {
+	switch {
+	case s.WaitTime >= 10*time.Minute,
+		strings.Contains(s.State, "nil chan"),
+		strings.Contains(s.State, "no cases"):
+		return sgrRed
+	case s.WaitTime > 0:
+		return sgrYellow
+	case s.State == "running", s.State == "runnable", s.State == "syscall":
+		return sgrGreen
+	default:
+		return sgrBold
+	}
+}
+
+func (p *stackPrinter) frameColor(f *util.Frame) string {
+	for _, h := range p.highlight {
+		if f.Matches(h) {
+			return sgrMatch
+		}
+	}
+	if f.IsStdlib() || f.IsVendored() {
+		return sgrDim
+	}
+	return ""
+}
+
+func (p *stackPrinter) writeFrame(sb *strings.Builder, f *util.Frame, opts renderOpts) {
+	if f.Collapsed > 0 {
+		if opts.color {
+			sb.WriteString(sgrDim + f.String() + sgrReset + "\n")
+		} else {
+			sb.WriteString(f.String() + "\n")
+		}
+		return
+	}
+
+	loc := fmt.Sprintf("%s:%d", f.File, f.Line)
+	if p.shortPaths {
+		loc = f.Location()
+	}
+	if opts.links {
+		if url := p.linker.URL(f); url != "" {
+			loc = hyperlink(url, loc)
+		}
+	}
+
+	var color string
+	if opts.color {
+		color = p.frameColor(f)
+	}
+
+	sb.WriteString(color)
+	sb.WriteString(fmt.Sprintf("%s(%s)\n", f.Function, strings.Join(f.Params, ", ")))
+	sb.WriteString("\t" + loc)
+	if f.Entry != 0 {
+		sb.WriteString(fmt.Sprintf(" %+#x", f.Entry))
+	}
+	if color != "" {
+		sb.WriteString(sgrReset)
+	}
+	sb.WriteRune('\n')
+}
+
+// hyperlink wraps text in an OSC 8 escape sequence linking to url.
+func hyperlink(url, text string) string {
+	return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+func (p *stackPrinter) writeSource(sb *strings.Builder, f *util.Frame) {
+	if f.Collapsed > 0 || (p.userOnly && f.IsStdlib()) {
+		return
+	}
+
+	for _, l := range p.source.Context(f.File, f.Line, p.contextLines) {
+		marker := " "
+		if l.Number == f.Line {
+			marker = ">"
+		}
+		sb.WriteString(fmt.Sprintf("\t%s %5d  %s\n", marker, l.Number, l.Text))
+	}
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// session tracks the stack of filters applied during an interactive
+// investigation so they can be listed and popped off again.
+type session struct {
+	stk [][]*util.Stack
+	ops []string
+}
+
+func newSession(input []*util.Stack) *session {
+	return &session{
+		stk: [][]*util.Stack{input},
+		ops: []string{"."},
+	}
+}
+
+func (s *session) cur() []*util.Stack {
+	return s.stk[len(s.stk)-1]
+}
+
+// push narrows the current set with the given filters and records op as the
+// command that produced it.
+func (s *session) push(op string, filters []util.Filter) {
+	s.stk = append(s.stk, util.ApplyFilters(s.cur(), filters))
+	s.ops = append(s.ops, op)
+}
+
+func (s *session) pop() {
+	if len(s.stk) > 1 {
+		s.stk = s.stk[:len(s.stk)-1]
+		s.ops = s.ops[:len(s.ops)-1]
+	}
+}
+
+type replState struct {
+	sess     *session
+	bynumber map[int]*util.Stack
+
+	compfunc   util.StackCompFunc
+	formatType string
+	outputType string
+	fmtConfig  *formatConfig
+
+	out io.Writer
+
+	// interactive is set when there is someone at the prompt, for script
+	// commands to be echoed as though they had been typed.
+	interactive bool
+
+	// scripts are the scripts being run, to catch ones that load
+	// themselves.
+	scripts map[string]bool
+
+	frameNameCache []string
+}
+
+// sorted returns a sorted copy of the current set of stacks.
+func (r *replState) sorted() []*util.Stack {
+	stacks := append([]*util.Stack(nil), r.sess.cur()...)
+	sort.Stable(util.StackSorter{
+		Stacks:   stacks,
+		CompFunc: r.compfunc,
+	})
+	return stacks
+}
+
+func (r *replState) formatter() formatter {
+	f, err := newFormatter(r.formatType, r.fmtConfig)
+	if err != nil {
+		// formatType is validated whenever it is set
+		panic(err)
+	}
+	return f
+}
+
+type replCommand struct {
+	names []string
+	args  string
+	help  string
+	run   func(r *replState, line string, args []string) error
+
+	// complete lists candidate arguments for tab completion
+	complete func(r *replState) []string
+
+	// joinArgs is set for commands taking a single argument that may
+	// contain spaces, such as a state
+	joinArgs bool
+}
+
+var replCommands []*replCommand
+
+func init() {
+	replCommands = []*replCommand{
+		filterCommand("--frame-match", false, "keep only stacks with a frame containing each value", "fm", "frame-match"),
+		filterCommand("--frame-not-match", false, "drop stacks with a frame containing any value", "fnm", "frame-not-match"),
+		filterCommand("--state-match", true, "keep only stacks in the given state", "sm", "state-match"),
+		filterCommand("--state-not-match", true, "drop stacks in the given state", "snm", "state-not-match"),
+		filterCommand("--wait-more-than", false, "keep only stacks blocked for at least the given duration", "wmt", "wait-more-than"),
+		filterCommand("--wait-less-than", false, "keep only stacks blocked for less than the given duration", "wlt", "wait-less-than"),
+		filterCommand("--blocked-on", false, "keep only stacks blocked for one of the given reasons", "bo", "blocked-on"),
+		{
+			names: []string{"pop"},
+			help:  "undo the most recent filter",
+			run: func(r *replState, line string, args []string) error {
+				r.sess.pop()
+				return nil
+			},
+		},
+		{
+			names: []string{"diff"},
+			help:  "list the filters applied so far and how many goroutines each left",
+			run: func(r *replState, line string, args []string) error {
+				for i, op := range r.sess.ops {
+					fmt.Fprintf(r.out, "%d (%d): %s\n", i, len(r.sess.stk[i]), op)
+				}
+				return nil
+			},
+		},
+		{
+			names: []string{"show", "p", "print"},
+			args:  "[goroutine number]",
+			help:  "print the current stacks, or a single goroutine by number",
+			run: func(r *replState, line string, args []string) error {
+				if len(args) == 0 {
+					return r.formatter().formatStacks(r.out, r.sorted())
+				}
+				num, err := strconv.Atoi(args[0])
+				if err != nil {
+					return err
+				}
+				s, ok := r.bynumber[num]
+				if !ok {
+					return fmt.Errorf("no stack found with that number")
+				}
+				return r.formatter().formatStacks(r.out, []*util.Stack{s})
+			},
+		},
+		{
+			names: []string{"s", "summary", "sum"},
+			args:  "[function|reason]",
+			help:  "print a summary of the current stacks, by top function or blocking reason",
+			run: func(r *replState, line string, args []string) error {
+				by := r.fmtConfig.summaryBy
+				if len(args) > 0 {
+					by = args[0]
+				}
+				key, err := checkSummaryBy(by)
+				if err != nil {
+					return err
+				}
+				return r.formatter().formatSummaries(r.out, summarizeBy(r.sess.cur(), key))
+			},
+			complete: func(r *replState) []string {
+				return []string{"function", "reason"}
+			},
+		},
+		{
+			names: []string{"top"},
+			args:  "[count] [flat|cum]",
+			help:  "print the functions the current stacks are in, like pprof -top",
+			run: func(r *replState, line string, args []string) error {
+				opts := r.fmtConfig.top
+				for _, a := range args {
+					if n, err := strconv.Atoi(a); err == nil {
+						opts.count = n
+					} else if err := checkTopSort(a); err == nil {
+						opts.sortBy = a
+					} else {
+						return err
+					}
+				}
+				return writeOutput(r.out, r.formatter(), &formatConfig{top: opts}, "top", r.sess.cur())
+			},
+			complete: func(r *replState) []string {
+				return []string{"flat", "cum"}
+			},
+		},
+		{
+			names: []string{"unique", "uu"},
+			help:  "print each distinct stack once with its count and wait times",
+			run: func(r *replState, line string, args []string) error {
+				printUnique(r.sorted())
+				return nil
+			},
+		},
+		{
+			names: []string{"sus"},
+			help:  "rank groups of stacks by how suspicious they look",
+			run: func(r *replState, line string, args []string) error {
+				return writeOutput(r.out, r.formatter(), r.fmtConfig, "sus", r.sess.cur())
+			},
+		},
+		{
+			names: []string{"framestat"},
+			args:  "[count] [function|line]",
+			help:  "print how many stacks pass through each function or line, and their callers",
+			run: func(r *replState, line string, args []string) error {
+				opts := r.fmtConfig.frameStat
+				for _, a := range args {
+					if n, err := strconv.Atoi(a); err == nil {
+						opts.count = n
+					} else if err := checkFrameStatBy(a); err == nil {
+						opts.by = a
+					} else {
+						return err
+					}
+				}
+				return writeOutput(r.out, r.formatter(), &formatConfig{frameStat: opts}, "framestat", r.sess.cur())
+			},
+			complete: func(r *replState) []string {
+				return []string{"function", "line"}
+			},
+		},
+		{
+			names: []string{"sort"},
+			args:  "goronum|stacksize|waittime|reason",
+			help:  "change the order stacks are printed in",
+			complete: func(r *replState) []string {
+				return []string{"goronum", "stacksize", "waittime", "reason"}
+			},
+			run: func(r *replState, line string, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("usage: sort goronum|stacksize|waittime|reason")
+				}
+				cf, err := parseSort(args[0])
+				if err != nil {
+					return err
+				}
+				r.compfunc = cf
+				return nil
+			},
+		},
+		{
+			names: []string{"format"},
+			args:  "default|go|json|ndjson|csv|tsv|html|markdown|template",
+			help:  "change the format stacks and summaries are printed in",
+			complete: func(r *replState) []string {
+				return []string{"default", "go", "json", "ndjson", "csv", "tsv", "html", "markdown", "template"}
+			},
+			run: func(r *replState, line string, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("usage: format default|go|json|ndjson|csv|tsv|html|markdown|template")
+				}
+				if _, err := newFormatter(args[0], r.fmtConfig); err != nil {
+					return err
+				}
+				r.formatType = args[0]
+				return nil
+			},
+		},
+		{
+			names: []string{"output"},
+			args:  "full|summary|top|sus|framestat|series",
+			help:  "change what save writes out",
+			complete: func(r *replState) []string {
+				return []string{"full", "summary", "top", "sus", "framestat", "series"}
+			},
+			run: func(r *replState, line string, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("usage: output full|summary|top|sus|framestat|series")
+				}
+				if err := checkOutputType(args[0]); err != nil {
+					return err
+				}
+				r.outputType = args[0]
+				return nil
+			},
+		},
+		{
+			names: []string{"save"},
+			args:  "<file>",
+			help:  "write the current stacks to a file using the current output and format",
+			run: func(r *replState, line string, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("usage: save <file>")
+				}
+				fi, err := os.Create(args[0])
+				if err != nil {
+					return err
+				}
+				defer fi.Close()
+
+				if err := writeOutput(fi, r.formatter(), r.fmtConfig, r.outputType, r.sorted()); err != nil {
+					return err
+				}
+				return fi.Close()
+			},
+		},
+		{
+			names: []string{"record"},
+			args:  "<file>",
+			help:  "save the filters applied so far as a script",
+			run: func(r *replState, line string, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("usage: record <file>")
+				}
+				return r.record(args[0])
+			},
+		},
+		{
+			names: []string{"load"},
+			args:  "<file>",
+			help:  "run the commands in a script, such as one saved by record",
+			run: func(r *replState, line string, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("usage: load <file>")
+				}
+				return r.runScript(args[0])
+			},
+		},
+		{
+			names: []string{"help", "?"},
+			help:  "list the available commands",
+			run: func(r *replState, line string, args []string) error {
+				tw := tabwriter.NewWriter(r.out, 8, 4, 2, ' ', 0)
+				for _, c := range replCommands {
+					fmt.Fprintf(tw, "%s %s\t%s\n", strings.Join(c.names, ", "), c.args, c.help)
+				}
+				return tw.Flush()
+			},
+		},
+	}
+}
+
+// filterCommand builds a repl command from one of the CLI filter flags. Each
+// argument becomes its own filter unless joinArgs is set, in which case the
+// rest of the line is the value (states like 'chan receive' contain spaces).
+func filterCommand(flag string, joinArgs bool, help string, names ...string) *replCommand {
+	var complete func(r *replState) []string
+	switch flag {
+	case "--frame-match", "--frame-not-match":
+		complete = (*replState).frameNames
+	case "--state-match", "--state-not-match":
+		complete = (*replState).stateNames
+	case "--blocked-on":
+		complete = func(r *replState) []string {
+			return util.BlockReasons
+		}
+	}
+
+	args := "<value>..."
+	if joinArgs {
+		args = "<value>"
+	}
+	return &replCommand{
+		names:    names,
+		args:     args,
+		help:     help,
+		complete: complete,
+		joinArgs: joinArgs,
+		run: func(r *replState, line string, args []string) error {
+			if joinArgs && len(args) > 0 {
+				args = []string{strings.Join(args, " ")}
+			}
+			if flag == "--blocked-on" && len(args) > 0 {
+				// any of the reasons, rather than all of them
+				args = []string{strings.Join(args, ",")}
+			}
+
+			var filters []util.Filter
+			for _, a := range args {
+				filt, _, err := parseFilter(flag, a)
+				if err != nil {
+					return err
+				}
+				filters = append(filters, filt)
+			}
+
+			r.sess.push(line, filters)
+			return nil
+		},
+	}
+}
+
+func findReplCommand(name string) *replCommand {
+	for _, c := range replCommands {
+		for _, n := range c.names {
+			if n == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// exec runs a single line of repl input.
+func (r *replState) exec(line string) error {
+	line = strings.TrimSpace(line)
+	parts := strings.Fields(line)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	c := findReplCommand(parts[0])
+	if c == nil {
+		return fmt.Errorf("unknown command %q, try 'help'", parts[0])
+	}
+	return c.run(r, line, parts[1:])
+}
+
+// runScript executes the repl commands in the given file, one per line,
+// stopping at the first one that fails. Blank lines and lines starting with
+// '#' are ignored, which is also the format written by 'record'.
+func (r *replState) runScript(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if r.scripts[abs] {
+		return fmt.Errorf("%s is already being run", path)
+	}
+
+	fi, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	if r.scripts == nil {
+		r.scripts = make(map[string]bool)
+	}
+	r.scripts[abs] = true
+	defer delete(r.scripts, abs)
+
+	lineNo := 0
+	scan := bufio.NewScanner(fi)
+	for scan.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if r.interactive {
+			fmt.Fprintf(r.out, "stackparse> %s\n", line)
+		}
+		if err := r.exec(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scan.Err()
+}
+
+// record writes the filters applied so far as a script that can be replayed
+// against another dump with 'load' or --script.
+func (r *replState) record(path string) error {
+	fi, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	fmt.Fprintf(fi, "# stackparse investigation, %d of %d goroutines matched\n", len(r.sess.cur()), len(r.sess.stk[0]))
+	for _, op := range r.sess.ops[1:] {
+		fmt.Fprintln(fi, op)
+	}
+	return fi.Close()
+}
+
+// complete offers command names for the first word of the line and defers
+// to the command's own completer for its arguments.
+func (r *replState) complete(line string) (int, []string) {
+	start := strings.LastIndexByte(line, ' ') + 1
+	word := line[start:]
+
+	fields := strings.Fields(line[:start])
+	if len(fields) == 0 {
+		var names []string
+		for _, c := range replCommands {
+			names = append(names, c.names...)
+		}
+		return start, matchCandidates(names, word)
+	}
+
+	c := findReplCommand(fields[0])
+	if c == nil || c.complete == nil {
+		return start, nil
+	}
+	if c.joinArgs {
+		// the argument is everything after the command
+		cmd := strings.Index(line, fields[0]) + len(fields[0])
+		start = len(line) - len(strings.TrimLeft(line[cmd:], " "))
+		word = line[start:]
+	}
+	return start, matchCandidates(c.complete(r), word)
+}
+
+// frameNames returns every function and package name found in the input
+// stacks, for completing frame match arguments.
+func (r *replState) frameNames() []string {
+	if r.frameNameCache == nil {
+		seen := make(map[string]bool)
+		add := func(n string) {
+			if n != "" && !seen[n] {
+				seen[n] = true
+				r.frameNameCache = append(r.frameNameCache, n)
+			}
+		}
+		for _, s := range r.sess.stk[0] {
+			for _, f := range s.Frames {
+				add(f.Function)
+				add(f.Package())
+			}
+		}
+	}
+	return r.frameNameCache
+}
+
+func (r *replState) stateNames() []string {
+	seen := make(map[string]bool)
+	var states []string
+	for _, s := range r.sess.cur() {
+		if !seen[s.State] {
+			seen[s.State] = true
+			states = append(states, s.State)
+		}
+	}
+	return states
+}
+
+func newReplState(input []*util.Stack, compfunc util.StackCompFunc, formatType, outputType string, fmtConfig *formatConfig) *replState {
+	r := &replState{
+		sess:       newSession(input),
+		bynumber:   make(map[int]*util.Stack),
+		compfunc:   compfunc,
+		formatType: formatType,
+		outputType: outputType,
+		fmtConfig:  fmtConfig,
+		out:        os.Stdout,
+	}
+	for _, i := range input {
+		r.bynumber[i.Number] = i
+	}
+	return r
+}
+
+func (r *replState) run() {
+	// Only bother with line editing when a person is typing at us.
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		ed, err := newLineEditor("stackparse> ", r.complete)
+		if err == nil {
+			defer ed.Close()
+			for {
+				line, err := ed.readLine()
+				if err != nil {
+					if err != io.EOF {
+						fmt.Println(err)
+					}
+					return
+				}
+				if err := r.exec(line); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
+	}
+
+	scan := bufio.NewScanner(os.Stdin)
+	fmt.Print("stackparse> ")
+	for scan.Scan() {
+		if err := r.exec(scan.Text()); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Print("stackparse> ")
+	}
+}
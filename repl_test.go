@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// testReplState returns a replState over stacks writing to a buffer.
+func testReplState(stacks []*util.Stack) (*replState, *bytes.Buffer) {
+	var buf bytes.Buffer
+	r := newReplState(stacks, util.CompGoroNum, "default", "stacks", &formatConfig{})
+	r.out = &buf
+	return r, &buf
+}
+
+func TestReplComplete(t *testing.T) {
+	r, _ := testReplState([]*util.Stack{
+		testStack("chan receive", "main.a"),
+		testStack("chan receive", "main.b"),
+		testStack("chan send", "main.c"),
+		testStack("select", "main.d"),
+	})
+
+	if got := r.stateNames(); !reflect.DeepEqual(got, []string{"chan receive", "chan send", "select"}) {
+		t.Errorf("expected each state once, got %v", got)
+	}
+
+	cases := []struct {
+		line     string
+		start    int
+		expected []string
+	}{
+		{"sta", 0, []string{"state-match", "state-not-match"}},
+		// states are completed as a whole, spaces and all
+		{"sm chan re", 3, []string{"chan receive"}},
+		{"sm  chan", 4, []string{"chan receive", "chan send"}},
+		{"sm re", 3, []string{"chan receive"}},
+		{"fm main.", 3, []string{"main.a", "main.b", "main.c", "main.d"}},
+		{"fm foo main.b", 7, []string{"main.b"}},
+	}
+	for _, c := range cases {
+		start, got := r.complete(c.line)
+		if start != c.start || !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%q: expected %v from %d, got %v from %d", c.line, c.expected, c.start, got, start)
+		}
+	}
+}
+
+func TestReplRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackparse-repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stacks := []*util.Stack{
+		testStack("select", "main.worker", "main.main"),
+		testStack("select", "main.worker", "main.other"),
+		testStack("running", "main.main"),
+	}
+
+	r, _ := testReplState(stacks)
+	for _, line := range []string{"fm main.worker", "fnm main.other"} {
+		if err := r.exec(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := filepath.Join(dir, "investigation.txt")
+	if err := r.record(script); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, buf := testReplState(stacks)
+	if err := replay.runScript(script); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replay.sess.ops, r.sess.ops) || !reflect.DeepEqual(replay.sess.cur(), r.sess.cur()) {
+		t.Fatalf("expected %v leaving %v, got %v leaving %v", r.sess.ops, r.sess.cur(), replay.sess.ops, replay.sess.cur())
+	}
+	if len(replay.sess.cur()) != 1 || replay.sess.cur()[0] != stacks[0] {
+		t.Fatalf("unexpected stacks after replay: %v", replay.sess.cur())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output outside the prompt, got %q", buf.String())
+	}
+
+	loop := filepath.Join(dir, "loop.txt")
+	if err := ioutil.WriteFile(loop, []byte("load "+loop+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.runScript(loop); err == nil || !strings.Contains(err.Error(), "already being run") {
+		t.Fatalf("expected a script loading itself to fail, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// seriesSnapshot describes one dump in a series.
+type seriesSnapshot struct {
+	Index      int
+	Time       string `json:",omitempty"`
+	Goroutines int
+}
+
+// seriesRow counts the goroutines with one summary key in each dump, along
+// with the change from the first dump to the last.
+type seriesRow struct {
+	Key    string
+	Counts []int
+	Change int
+}
+
+// snapshotSeries is the series output mode, comparing several dumps of the
+// same process to see what is growing.
+type snapshotSeries struct {
+	Snapshots []seriesSnapshot
+	Rows      []seriesRow
+}
+
+type seriesFormatter interface {
+	formatSeries(io.Writer, *snapshotSeries) error
+}
+
+func computeSeries(snaps []*util.Snapshot, key func(*util.Stack) string) *snapshotSeries {
+	series := &snapshotSeries{}
+	index := make(map[string]*seriesRow)
+	var rows []*seriesRow
+	for i, snap := range snaps {
+		ss := seriesSnapshot{
+			Index:      i + 1,
+			Goroutines: len(snap.Stacks),
+		}
+		if !snap.Time.IsZero() {
+			ss.Time = snap.Time.Format(time.RFC3339Nano)
+		}
+		series.Snapshots = append(series.Snapshots, ss)
+
+		for _, s := range snap.Stacks {
+			k := key(s)
+			row, ok := index[k]
+			if !ok {
+				row = &seriesRow{Key: k, Counts: make([]int, len(snaps))}
+				index[k] = row
+				rows = append(rows, row)
+			}
+			row.Counts[i]++
+		}
+	}
+
+	for _, row := range rows {
+		if len(row.Counts) > 0 {
+			row.Change = row.Counts[len(row.Counts)-1] - row.Counts[0]
+		}
+		series.Rows = append(series.Rows, *row)
+	}
+
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	sort.SliceStable(series.Rows, func(i, j int) bool {
+		a, b := series.Rows[i], series.Rows[j]
+		if abs(a.Change) != abs(b.Change) {
+			return abs(a.Change) > abs(b.Change)
+		}
+		return a.Counts[len(a.Counts)-1] > b.Counts[len(b.Counts)-1]
+	})
+	return series
+}
+
+// label names a dump in column headers, by time if it has one.
+func (s seriesSnapshot) label() string {
+	if t, err := time.Parse(time.RFC3339Nano, s.Time); err == nil {
+		return t.Format("15:04:05")
+	}
+	return fmt.Sprintf("#%d", s.Index)
+}
+
+func (t *defaultFormatter) formatSeries(w io.Writer, series *snapshotSeries) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	for _, s := range series.Snapshots {
+		fmt.Fprintf(tw, "%s\t", s.label())
+	}
+	fmt.Fprintf(tw, "change\t\n")
+	for _, s := range series.Snapshots {
+		fmt.Fprintf(tw, "%d\t", s.Goroutines)
+	}
+	fmt.Fprintf(tw, "\t  total\n")
+	for _, r := range series.Rows {
+		for _, c := range r.Counts {
+			fmt.Fprintf(tw, "%d\t", c)
+		}
+		fmt.Fprintf(tw, "%+d\t  %s\n", r.Change, r.Key)
+	}
+	return tw.Flush()
+}
+
+func (j *jsonFormatter) formatSeries(w io.Writer, series *snapshotSeries) error {
+	return json.NewEncoder(w).Encode(series)
+}
+
+func (n *ndjsonFormatter) formatSeries(w io.Writer, series *snapshotSeries) error {
+	enc := json.NewEncoder(w)
+	for _, r := range series.Rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvFormatter) formatSeries(w io.Writer, series *snapshotSeries) error {
+	cw := c.writer(w)
+	header := []string{"key"}
+	for _, s := range series.Snapshots {
+		header = append(header, s.label())
+	}
+	cw.Write(append(header, "change"))
+	for _, r := range series.Rows {
+		row := []string{r.Key}
+		for _, n := range r.Counts {
+			row = append(row, strconv.Itoa(n))
+		}
+		cw.Write(append(row, strconv.Itoa(r.Change)))
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+func TestComputeSeries(t *testing.T) {
+	dump := func(counts map[string]int) []*util.Stack {
+		var stacks []*util.Stack
+		for fn, n := range counts {
+			for i := 0; i < n; i++ {
+				stacks = append(stacks, testStack("select", fn))
+			}
+		}
+		return stacks
+	}
+	snaps := []*util.Snapshot{
+		{Stacks: dump(map[string]int{"a": 2, "b": 5, "c": 1})},
+		{Time: time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC), Stacks: dump(map[string]int{"a": 6, "b": 1, "d": 2})},
+	}
+
+	expected := &snapshotSeries{
+		Snapshots: []seriesSnapshot{
+			{Index: 1, Goroutines: 8},
+			{Index: 2, Time: "2021-03-04T10:00:00Z", Goroutines: 9},
+		},
+		// biggest change either way first, then by the latest count
+		Rows: []seriesRow{
+			{Key: "a", Counts: []int{2, 6}, Change: 4},
+			{Key: "b", Counts: []int{5, 1}, Change: -4},
+			{Key: "d", Counts: []int{0, 2}, Change: 2},
+			{Key: "c", Counts: []int{1, 0}, Change: -1},
+		},
+	}
+	if got := computeSeries(snaps, topFunctionKey); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected\n%+v\ngot\n%+v", expected, got)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// finding is a group of identical stacks that looks worth a closer look,
+// along with a score to rank it by and the reasons it was flagged.
+type finding struct {
+	Score      float64
+	Count      int
+	Function   string
+	MedianWait time.Duration
+	MaxWait    time.Duration
+	Reasons    []string
+	Stack      *util.Stack
+}
+
+type susOptions struct {
+	// baseline, if set, is an earlier dump of the same process. Groups that
+	// have grown since then are flagged.
+	baseline []*util.Stack
+}
+
+type susFormatter interface {
+	formatFindings(io.Writer, []finding) error
+}
+
+// blockingObject returns the function a goroutine is blocked in and the
+// address of the mutex, wait group or channel it is blocked on, if that
+// can be told from its frames. Only the runtime and sync frames at the top
+// of the stack are looked at, a sync.Once further down isn't what the
+// goroutine is blocked on.
+func blockingObject(s *util.Stack) (string, string) {
+	for i := range s.Frames {
+		f := &s.Frames[i]
+		switch {
+		case strings.HasPrefix(f.Function, "sync.(*"),
+			strings.HasPrefix(f.Function, "runtime.chanrecv"),
+			strings.HasPrefix(f.Function, "runtime.chansend"):
+		case f.IsRuntime() || f.Package() == "sync":
+			continue
+		default:
+			return "", ""
+		}
+		if len(f.Params) == 0 || !strings.HasPrefix(f.Params[0], "0x") {
+			return "", ""
+		}
+		return f.Function, f.Params[0]
+	}
+	return "", ""
+}
+
+// findSuspicious groups identical stacks and scores each group on the
+// signals that tend to point at leaks and deadlocks. Groups that don't trip
+// any signal are left out, the rest are returned most suspicious first.
+func findSuspicious(stacks []*util.Stack, opts susOptions) []finding {
+	if len(stacks) == 0 {
+		return nil
+	}
+
+	objects := make(map[string]int)
+	var sum, sumSq float64
+	for _, s := range stacks {
+		if fn, addr := blockingObject(s); addr != "" {
+			objects[fn+" "+addr]++
+		}
+		d := float64(len(s.Frames))
+		sum += d
+		sumSq += d * d
+	}
+	meanDepth := sum / float64(len(stacks))
+	stddevDepth := math.Sqrt(math.Max(sumSq/float64(len(stacks))-meanDepth*meanDepth, 0))
+
+	var before map[string]int
+	if opts.baseline != nil {
+		before = make(map[string]int)
+		for _, s := range opts.baseline {
+			before[uniqueKey(s)]++
+		}
+	}
+
+	var findings []finding
+	for _, g := range groupStacks(stacks, uniqueKey) {
+		n := len(g.Stacks)
+		ws := compWaitStats(g.Stacks)
+		f := finding{
+			Count:      n,
+			Function:   topFunctionKey(g.Rep),
+			MedianWait: ws.Median,
+			MaxWait:    ws.Max,
+			Stack:      g.Rep,
+		}
+		flag := func(score float64, format string, args ...interface{}) {
+			f.Score += score
+			f.Reasons = append(f.Reasons, fmt.Sprintf(format, args...))
+		}
+
+		share := float64(n) / float64(len(stacks))
+		if n >= 10 && share >= 0.05 {
+			flag(100*share, "%d goroutines (%.0f%% of all) have this stack", n, 100*share)
+		}
+
+		if ws.Median >= 10*time.Minute {
+			flag(10+math.Min(ws.Median.Minutes()/6, 40), "median wait %s, max %s", formatDuration(ws.Median), formatDuration(ws.Max))
+		}
+
+		var obj string
+		for _, s := range g.Stacks {
+			if fn, addr := blockingObject(s); addr != "" && objects[fn+" "+addr] > objects[obj] {
+				obj = fn + " " + addr
+			}
+		}
+		if c := objects[obj]; c > 1 {
+			parts := strings.SplitN(obj, " ", 2)
+			flag(10+math.Min(float64(c), 40), "%d goroutines are blocked in %s on the same object %s", c, parts[0], parts[1])
+		}
+
+		switch {
+		case strings.Contains(g.Rep.State, "nil chan"):
+			flag(50, "blocked forever on a nil channel")
+		case strings.Contains(g.Rep.State, "no cases"):
+			flag(50, "blocked forever in a select with no cases")
+		}
+
+		depth := len(g.Rep.Frames)
+		switch {
+		case g.Rep.FramesElided || g.Rep.ElidedCount > 0:
+			flag(30, "stack is too deep to print in full, which may be runaway recursion")
+		case depth >= 32 && float64(depth) > meanDepth+3*stddevDepth:
+			flag(30, "stack is %d frames deep, against an average of %.0f", depth, meanDepth)
+		}
+
+		if before != nil {
+			b := before[g.Key]
+			switch {
+			case b == 0 && n >= 5:
+				flag(math.Min(float64(2*n), 50), "%d goroutines with this stack appeared since the baseline", n)
+			case b > 0 && n >= 2*b:
+				flag(math.Min(10*float64(n)/float64(b), 50), "grew from %d to %d goroutines since the baseline", b, n)
+			}
+		}
+
+		if f.Score > 0 {
+			findings = append(findings, f)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Count > b.Count
+	})
+	return findings
+}
+
+func (t *defaultFormatter) formatFindings(w io.Writer, findings []finding) error {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "nothing looks suspicious")
+		return nil
+	}
+
+	for i, f := range findings {
+		fmt.Fprintf(w, "#%d score %.0f: %d x %s\n", i+1, f.Score, f.Count, f.Function)
+		for _, r := range f.Reasons {
+			fmt.Fprintf(w, "  - %s\n", r)
+		}
+		fmt.Fprintln(w)
+		if err := t.printer.writeStack(w, f.Stack); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func (j *jsonFormatter) formatFindings(w io.Writer, findings []finding) error {
+	return json.NewEncoder(w).Encode(findings)
+}
+
+func (n *ndjsonFormatter) formatFindings(w io.Writer, findings []finding) error {
+	enc := json.NewEncoder(w)
+	for _, f := range findings {
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+func TestFindSuspicious(t *testing.T) {
+	repeat := func(n int, s *util.Stack) []*util.Stack {
+		var out []*util.Stack
+		for i := 0; i < n; i++ {
+			out = append(out, s)
+		}
+		return out
+	}
+	lock := func(caller string) *util.Stack {
+		return testStack("semacquire",
+			"sync.runtime_SemacquireMutex(0xc000010004, 0x0, 0x1)",
+			"sync.(*Mutex).lockSlow(0xc000010000)",
+			"sync.(*Mutex).Lock(...)",
+			caller)
+	}
+
+	var stacks []*util.Stack
+	stacks = append(stacks, testStack("running", "main.main"))
+	stacks = append(stacks, lock("main.a"), lock("main.b"), lock("main.c"))
+	stacks = append(stacks, testStack("chan receive (nil chan)", "main.leak"))
+	stacks = append(stacks, repeat(6, testStack("select", "main.worker"))...)
+	stacks = append(stacks, repeat(5, testStack("select", "main.fresh"))...)
+	deep := testStack("running", "main.rec", "main.rec", "main.main")
+	deep.ElidedAt, deep.ElidedCount = 1, 100
+	stacks = append(stacks, deep)
+
+	baseline := []*util.Stack{testStack("running", "main.main")}
+	baseline = append(baseline, repeat(2, testStack("select", "main.worker"))...)
+
+	expected := []struct {
+		function string
+		count    int
+		reason   string
+	}{
+		{"main.leak", 1, "blocked forever on a nil channel"},
+		{"main.worker", 6, "grew from 2 to 6 goroutines since the baseline"},
+		{"main.rec", 1, "stack is too deep to print in full"},
+		{"sync.runtime_SemacquireMutex", 1, "3 goroutines are blocked in sync.(*Mutex).lockSlow on the same object 0xc000010000"},
+		{"sync.runtime_SemacquireMutex", 1, "3 goroutines are blocked"},
+		{"sync.runtime_SemacquireMutex", 1, "3 goroutines are blocked"},
+		{"main.fresh", 5, "5 goroutines with this stack appeared since the baseline"},
+	}
+
+	findings := findSuspicious(stacks, susOptions{baseline: baseline})
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got %+v", len(expected), findings)
+	}
+	for i, e := range expected {
+		f := findings[i]
+		if f.Function != e.function || f.Count != e.count || len(f.Reasons) != 1 || !strings.HasPrefix(f.Reasons[0], e.reason) {
+			t.Errorf("finding %d: expected %d x %s for %q, got %d x %s for %q", i, e.count, e.function, e.reason, f.Count, f.Function, f.Reasons)
+		}
+	}
+
+	// growth is only flagged against a baseline
+	for _, f := range findSuspicious(stacks, susOptions{}) {
+		if f.Function == "main.worker" || f.Function == "main.fresh" {
+			t.Errorf("unexpected finding without a baseline: %+v", f)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// ndjsonFormatter writes one JSON object per line, so output can be
+// processed a goroutine at a time with tools like jq -c.
+type ndjsonFormatter struct{}
+
+func (n *ndjsonFormatter) formatSummaries(w io.Writer, summaries []summary) error {
+	enc := json.NewEncoder(w)
+	for _, s := range summaries {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
+	enc := json.NewEncoder(w)
+	for _, s := range stacks {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvFormatter writes one flattened row per stack or summary, with a header
+// row first. It writes TSV if comma is a tab.
+type csvFormatter struct {
+	comma rune
+}
+
+func (c *csvFormatter) writer(w io.Writer) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if c.comma != 0 {
+		cw.Comma = c.comma
+	}
+	return cw
+}
+
+func (c *csvFormatter) formatSummaries(w io.Writer, summaries []summary) error {
+	cw := c.writer(w)
+	cw.Write([]string{"function", "count"})
+	for _, s := range summaries {
+		cw.Write([]string{s.Function, strconv.Itoa(s.Count)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (c *csvFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
+	cw := c.writer(w)
+	cw.Write([]string{"number", "state", "wait_seconds", "depth", "top_function", "created_by"})
+	for _, s := range stacks {
+		cw.Write([]string{
+			strconv.Itoa(s.Number),
+			s.State,
+			strconv.FormatInt(int64(s.WaitTime.Seconds()), 10),
+			strconv.Itoa(len(s.Frames)),
+			topFunctionKey(s),
+			s.CreatedBy.Function,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+func TestCSVFormatter(t *testing.T) {
+	s := testStack("chan receive", "github.com/me/app.Map[go.shape.int,go.shape.string]", "main.main")
+	s.Number, s.WaitTime = 7, 3*time.Minute
+	s.CreatedBy.Function = "main.start"
+	stacks := []*util.Stack{s}
+
+	cases := []struct {
+		comma    rune
+		expected string
+	}{
+		// the comma in the function name needs quoting
+		{0, "number,state,wait_seconds,depth,top_function,created_by\n" +
+			"7,chan receive,180,2,\"github.com/me/app.Map[go.shape.int,go.shape.string]\",main.start\n"},
+		{'\t', "number\tstate\twait_seconds\tdepth\ttop_function\tcreated_by\n" +
+			"7\tchan receive\t180\t2\tgithub.com/me/app.Map[go.shape.int,go.shape.string]\tmain.start\n"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := (&csvFormatter{comma: c.comma}).formatStacks(&buf, stacks); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", c.expected, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := (&csvFormatter{}).formatSummaries(&buf, []summary{{Function: "main.main", Count: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "function,count\nmain.main,3\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestNDJSONFormatter(t *testing.T) {
+	stacks := []*util.Stack{testStack("select", "main.a"), testStack("running", "main.b")}
+	stacks[0].Number, stacks[1].Number = 1, 2
+
+	var buf bytes.Buffer
+	if err := (&ndjsonFormatter{}).formatStacks(&buf, stacks); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per stack, got %q", buf.String())
+	}
+	for i, l := range lines {
+		var s util.Stack
+		if err := json.Unmarshal([]byte(l), &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Number != stacks[i].Number || s.Frames[0].Function != stacks[i].Frames[0].Function {
+			t.Errorf("line %d: unexpected stack %+v", i+1, s)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// templateFuncs are available to --template in addition to the text/template
+// builtins.
+var templateFuncs = template.FuncMap{
+	"topFrame":     topFrame,
+	"topUserFrame": topUserFrame,
+	"shortFunc":    shortFunc,
+	"duration":     formatDuration,
+	"location": func(f util.Frame) string {
+		return f.Location()
+	},
+	"package": func(f util.Frame) string {
+		return f.Package()
+	},
+	"join": strings.Join,
+}
+
+// parseTemplate parses a template given with --template, or read from a
+// file if fromFile is set.
+func parseTemplate(text string, fromFile bool) (*template.Template, error) {
+	name := "template"
+	if fromFile {
+		data, err := ioutil.ReadFile(text)
+		if err != nil {
+			return nil, err
+		}
+		name, text = text, string(data)
+	}
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// topFrame returns the innermost frame of the stack, or an empty frame.
+func topFrame(s *util.Stack) util.Frame {
+	if len(s.Frames) == 0 {
+		return util.Frame{}
+	}
+	return s.Frames[0]
+}
+
+// topUserFrame returns the innermost frame outside the standard library, or
+// an empty frame if there isn't one.
+func topUserFrame(s *util.Stack) util.Frame {
+	for _, f := range s.Frames {
+		if !f.IsStdlib() {
+			return f
+		}
+	}
+	return util.Frame{}
+}
+
+// shortFunc trims the import path off a function name, leaving e.g.
+// "swarm.(*Swarm).notifyAll".
+func shortFunc(fn string) string {
+	if n := strings.IndexByte(fn, '['); n >= 0 {
+		return shortFunc(fn[:n]) + fn[n:]
+	}
+	return fn[strings.LastIndexByte(fn, '/')+1:]
+}
+
+// formatDuration prints durations without trailing zero units, so 25
+// minutes is "25m" rather than "25m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// templateFormatter runs a user supplied template once per stack or summary,
+// adding a newline after each if the template doesn't end with one.
+type templateFormatter struct {
+	tmpl *template.Template
+}
+
+func (t *templateFormatter) execute(w io.Writer, data interface{}) error {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (t *templateFormatter) formatSummaries(w io.Writer, summaries []summary) error {
+	for _, s := range summaries {
+		if err := t.execute(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *templateFormatter) formatStacks(w io.Writer, stacks []*util.Stack) error {
+	for _, s := range stacks {
+		if err := t.execute(w, s); err != nil {
+			return fmt.Errorf("goroutine %d: %w", s.Number, err)
+		}
+	}
+	return nil
+}
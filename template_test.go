@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+func TestTemplateHelpers(t *testing.T) {
+	s := testStack("semacquire", "runtime.gopark", "sync.(*Mutex).Lock", "github.com/me/app.(*T).run", "main.main")
+	if f := topUserFrame(s); f.Function != "github.com/me/app.(*T).run" {
+		t.Errorf("expected the first frame outside the stdlib, got %q", f.Function)
+	}
+	if f := topUserFrame(testStack("select", "runtime.gopark", "net/http.(*Server).Serve")); f.Function != "" {
+		t.Errorf("expected no user frame, got %q", f.Function)
+	}
+
+	for fn, expected := range map[string]string{
+		"main.main": "main.main",
+		"github.com/libp2p/go-libp2p-swarm.(*Swarm).notifyAll": "go-libp2p-swarm.(*Swarm).notifyAll",
+		"github.com/me/app.Map[go.shape.int,go.shape.string]":  "app.Map[go.shape.int,go.shape.string]",
+	} {
+		if got := shortFunc(fn); got != expected {
+			t.Errorf("shortFunc(%q): expected %q, got %q", fn, expected, got)
+		}
+	}
+
+	for d, expected := range map[time.Duration]string{
+		30 * time.Second: "30s",
+		25 * time.Minute: "25m",
+		90 * time.Minute: "1h30m",
+		2 * time.Hour:    "2h",
+	} {
+		if got := formatDuration(d); got != expected {
+			t.Errorf("formatDuration(%s): expected %q, got %q", d, expected, got)
+		}
+	}
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	stacks := []*util.Stack{
+		testStack("select", "github.com/me/app.(*T).run"),
+		testStack("running", "main.main"),
+	}
+	stacks[0].Number, stacks[1].Number = 1, 2
+
+	for _, text := range []string{
+		"{{.Number}} {{shortFunc (topFrame .).Function}}",
+		// a newline is only added if the template doesn't end with one
+		"{{.Number}} {{shortFunc (topFrame .).Function}}\n",
+	} {
+		tmpl, err := parseTemplate(text, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := (&templateFormatter{tmpl: tmpl}).formatStacks(&buf, stacks); err != nil {
+			t.Fatal(err)
+		}
+		if expected := "1 app.(*T).run\n2 main.main\n"; buf.String() != expected {
+			t.Errorf("%q: expected %q, got %q", text, expected, buf.String())
+		}
+	}
+}
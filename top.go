@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// topEntry counts the goroutines a function appears in, in the style of
+// 'go tool pprof -top'. Flat counts goroutines with the function as their
+// top frame, Cum counts goroutines with the function anywhere on the stack.
+type topEntry struct {
+	Function    string
+	Flat        int
+	FlatPercent float64
+	SumPercent  float64
+	Cum         int
+	CumPercent  float64
+}
+
+type topOptions struct {
+	// count is the number of functions to show, or all of them if zero
+	count int
+	// sortBy is flat or cum
+	sortBy string
+}
+
+func checkTopSort(sortBy string) error {
+	switch sortBy {
+	case "flat", "cum":
+		return nil
+	default:
+		return fmt.Errorf("unrecognized top sort: %q\nvalid options are: flat, cum", sortBy)
+	}
+}
+
+type topFormatter interface {
+	formatTop(io.Writer, []topEntry, int) error
+}
+
+func computeTop(stacks []*util.Stack, opts topOptions) []topEntry {
+	flat := make(map[string]int)
+	cum := make(map[string]int)
+	for _, s := range stacks {
+		if len(s.Frames) > 0 {
+			flat[s.Frames[0].Function]++
+		}
+
+		// recursive functions only count once per goroutine
+		seen := make(map[string]bool)
+		for _, f := range s.Frames {
+			if !seen[f.Function] {
+				seen[f.Function] = true
+				cum[f.Function]++
+			}
+		}
+	}
+
+	total := float64(len(stacks))
+	var entries []topEntry
+	for fn, c := range cum {
+		entries = append(entries, topEntry{
+			Function:    fn,
+			Flat:        flat[fn],
+			FlatPercent: 100 * float64(flat[fn]) / total,
+			Cum:         c,
+			CumPercent:  100 * float64(c) / total,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if opts.sortBy == "cum" && a.Cum != b.Cum {
+			return a.Cum > b.Cum
+		}
+		if a.Flat != b.Flat {
+			return a.Flat > b.Flat
+		}
+		if a.Cum != b.Cum {
+			return a.Cum > b.Cum
+		}
+		return a.Function < b.Function
+	})
+
+	if opts.count > 0 && len(entries) > opts.count {
+		entries = entries[:opts.count]
+	}
+
+	var sum float64
+	for i := range entries {
+		sum += entries[i].FlatPercent
+		entries[i].SumPercent = sum
+	}
+	return entries
+}
+
+func (t *defaultFormatter) formatTop(w io.Writer, entries []topEntry, total int) error {
+	fmt.Fprintf(w, "Showing top %d functions of %d goroutines\n", len(entries), total)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "flat\tflat%%\tsum%%\tcum\tcum%%\t\n")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%d\t%.2f%%\t%.2f%%\t%d\t%.2f%%\t  %s\n", e.Flat, e.FlatPercent, e.SumPercent, e.Cum, e.CumPercent, e.Function)
+	}
+	return tw.Flush()
+}
+
+func (j *jsonFormatter) formatTop(w io.Writer, entries []topEntry, total int) error {
+	return json.NewEncoder(w).Encode(entries)
+}
+
+func (n *ndjsonFormatter) formatTop(w io.Writer, entries []topEntry, total int) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvFormatter) formatTop(w io.Writer, entries []topEntry, total int) error {
+	cw := c.writer(w)
+	cw.Write([]string{"flat", "flat_percent", "sum_percent", "cum", "cum_percent", "function"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.Itoa(e.Flat),
+			strconv.FormatFloat(e.FlatPercent, 'f', 2, 64),
+			strconv.FormatFloat(e.SumPercent, 'f', 2, 64),
+			strconv.Itoa(e.Cum),
+			strconv.FormatFloat(e.CumPercent, 'f', 2, 64),
+			e.Function,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (t *templateFormatter) formatTop(w io.Writer, entries []topEntry, total int) error {
+	for _, e := range entries {
+		if err := t.execute(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// testStack builds a stack from function lines as they appear in a dump,
+// innermost first, e.g. "sync.(*Mutex).Lock(0xc000010000)".
+func testStack(state string, frames ...string) *util.Stack {
+	s := &util.Stack{State: state}
+	for _, line := range frames {
+		f := util.Frame{Function: line}
+		if n := strings.LastIndexByte(line, '('); n > 0 && strings.HasSuffix(line, ")") {
+			f.Function = line[:n]
+			f.Params = strings.Split(line[n+1:len(line)-1], ", ")
+		}
+		s.Frames = append(s.Frames, f)
+	}
+	return s
+}
+
+func TestComputeTop(t *testing.T) {
+	stacks := []*util.Stack{
+		testStack("select", "a.wait", "a.loop", "main.main"),
+		// recursion only counts once
+		testStack("select", "a.wait", "a.loop", "a.loop"),
+		testStack("chan receive", "b.recv", "a.loop"),
+		testStack("running", "main.main"),
+	}
+
+	cases := []struct {
+		opts     topOptions
+		expected []topEntry
+	}{
+		{topOptions{sortBy: "flat"}, []topEntry{
+			{"a.wait", 2, 50, 50, 2, 50},
+			{"main.main", 1, 25, 75, 2, 50},
+			{"b.recv", 1, 25, 100, 1, 25},
+			{"a.loop", 0, 0, 100, 3, 75},
+		}},
+		{topOptions{sortBy: "cum"}, []topEntry{
+			{"a.loop", 0, 0, 0, 3, 75},
+			{"a.wait", 2, 50, 50, 2, 50},
+			{"main.main", 1, 25, 75, 2, 50},
+			{"b.recv", 1, 25, 100, 1, 25},
+		}},
+		// the sum is of the entries shown
+		{topOptions{sortBy: "flat", count: 2}, []topEntry{
+			{"a.wait", 2, 50, 50, 2, 50},
+			{"main.main", 1, 25, 75, 2, 50},
+		}},
+	}
+
+	for _, c := range cases {
+		got := computeTop(stacks, c.opts)
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%+v: expected\n%+v\ngot\n%+v", c.opts, c.expected, got)
+		}
+	}
+}
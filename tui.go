@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	util "github.com/whyrusleeping/stackparse/util"
+)
+
+// Special keys returned by terminal.readKey. Printable keys are returned as
+// their rune value, so these are all negative.
+const (
+	keyUp = -(iota + 1)
+	keyDown
+	keyLeft
+	keyRight
+	keyPgUp
+	keyPgDn
+	keyHome
+	keyEnd
+	keyEnter
+	keyEsc
+	keyBackspace
+	keyDelete
+	keyCtrlC
+	keyUnknown
+)
+
+// terminal is a minimal raw-mode wrapper around the controlling tty. It
+// shells out to stty rather than pulling in a terminal library, and reads
+// from /dev/tty so the dump itself can still be piped in on stdin.
+type terminal struct {
+	tty   *os.File
+	in    *bufio.Reader
+	out   *bufio.Writer
+	saved string
+}
+
+func openTerminal() (*terminal, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open terminal: %w", err)
+	}
+
+	t := &terminal{
+		tty: tty,
+		in:  bufio.NewReader(tty),
+		out: bufio.NewWriter(tty),
+	}
+
+	saved, err := t.stty("-g")
+	if err != nil {
+		tty.Close()
+		return nil, fmt.Errorf("failed to read terminal settings: %w", err)
+	}
+	t.saved = saved
+	return t, nil
+}
+
+func (t *terminal) stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = t.tty
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// makeRaw disables line buffering and echo. Note that output processing is
+// disabled too, so newlines must be written as "\r\n" until restore.
+func (t *terminal) makeRaw() error {
+	if _, err := t.stty("raw", "-echo"); err != nil {
+		return fmt.Errorf("failed to enter raw mode: %w", err)
+	}
+	return nil
+}
+
+// restore puts the terminal back the way openTerminal found it.
+func (t *terminal) restore() error {
+	_, err := t.stty(t.saved)
+	return err
+}
+
+func (t *terminal) Close() error {
+	t.restore()
+	return t.tty.Close()
+}
+
+// size returns the width and height of the terminal, falling back to 80x24
+// if stty can't tell us.
+func (t *terminal) size() (int, int) {
+	out, err := t.stty("size")
+	if err == nil {
+		parts := strings.Fields(out)
+		if len(parts) == 2 {
+			rows, err1 := strconv.Atoi(parts[0])
+			cols, err2 := strconv.Atoi(parts[1])
+			if err1 == nil && err2 == nil && rows > 0 && cols > 0 {
+				return cols, rows
+			}
+		}
+	}
+	return 80, 24
+}
+
+func (t *terminal) readKey() (rune, error) {
+	r, _, err := t.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return keyEnter, nil
+	case 127, 8:
+		return keyBackspace, nil
+	case 3:
+		return keyCtrlC, nil
+	case 27:
+	default:
+		return r, nil
+	}
+
+	// A lone escape is the escape key, otherwise it starts a sequence.
+	if t.in.Buffered() == 0 {
+		return keyEsc, nil
+	}
+	b, _ := t.in.ReadByte()
+	if b != '[' && b != 'O' {
+		return keyUnknown, nil
+	}
+
+	var seq []byte
+	for t.in.Buffered() > 0 {
+		c, _ := t.in.ReadByte()
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+
+	switch string(seq) {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "5~":
+		return keyPgUp, nil
+	case "6~":
+		return keyPgDn, nil
+	case "3~":
+		return keyDelete, nil
+	}
+	return keyUnknown, nil
+}
+
+// fit truncates or pads s to exactly w columns. Tabs are expanded since the
+// layout assumes one column per rune.
+func fit(s string, w int) string {
+	if w <= 0 {
+		return ""
+	}
+	rs := []rune(strings.Replace(s, "\t", "    ", -1))
+	if len(rs) > w {
+		return string(rs[:w])
+	}
+	return string(rs) + strings.Repeat(" ", w-len(rs))
+}
+
+const tuiHelp = "j/k move  J/K scroll  / search  f frame-match  F frame-not-match  p pop  u unique  s summary  a all  q quit"
+
+type tuiState struct {
+	term    *terminal
+	sess    *session
+	printer *stackPrinter
+
+	// mode is the grouping used for the left pane: unique, summary or all
+	mode   string
+	groups []*stackGroup
+
+	sel    int
+	top    int
+	scroll int
+
+	search string
+
+	// prompt is the label of the active input line, if any
+	prompt string
+	input  string
+	status string
+}
+
+func runTui(input []*util.Stack, printer *stackPrinter) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.Close()
+
+	if err := term.makeRaw(); err != nil {
+		return err
+	}
+
+	// switch to the alternate screen and hide the cursor while we're running
+	term.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		term.out.WriteString("\x1b[?25h\x1b[?1049l")
+		term.out.Flush()
+	}()
+
+	t := &tuiState{
+		term:    term,
+		sess:    newSession(input),
+		printer: printer,
+		mode:    "unique",
+	}
+	t.regroup()
+
+	for {
+		t.draw()
+
+		k, err := term.readKey()
+		if err != nil {
+			return err
+		}
+
+		t.status = ""
+		if t.prompt != "" {
+			t.handlePrompt(k)
+			continue
+		}
+
+		switch k {
+		case 'q', keyCtrlC:
+			return nil
+		case 'j', keyDown:
+			t.moveTo(t.sel + 1)
+		case 'k', keyUp:
+			t.moveTo(t.sel - 1)
+		case keyPgDn:
+			t.moveTo(t.sel + t.listHeight())
+		case keyPgUp:
+			t.moveTo(t.sel - t.listHeight())
+		case 'g', keyHome:
+			t.moveTo(0)
+		case 'G', keyEnd:
+			t.moveTo(len(t.groups) - 1)
+		case 'J', keyRight:
+			t.scroll++
+		case 'K', keyLeft:
+			if t.scroll > 0 {
+				t.scroll--
+			}
+		case '/':
+			t.prompt = "search"
+			t.input = t.search
+		case 'f':
+			t.prompt = "frame-match"
+			t.input = ""
+		case 'F':
+			t.prompt = "frame-not-match"
+			t.input = ""
+		case 'p':
+			t.sess.pop()
+			t.regroup()
+			t.status = fmt.Sprintf("popped, %d goroutines", len(t.sess.cur()))
+		case 'u':
+			t.mode = "unique"
+			t.regroup()
+		case 's':
+			t.mode = "summary"
+			t.regroup()
+		case 'a':
+			t.mode = "all"
+			t.regroup()
+		case keyEsc:
+			if t.search != "" {
+				t.search = ""
+				t.regroup()
+			}
+		}
+	}
+}
+
+func (t *tuiState) handlePrompt(k rune) {
+	switch k {
+	case keyEnter:
+		val := strings.TrimSpace(t.input)
+		switch t.prompt {
+		case "frame-match":
+			if val != "" {
+				t.sess.push("fm "+val, []util.Filter{util.HasFrameMatching(val)})
+			}
+		case "frame-not-match":
+			if val != "" {
+				t.sess.push("fnm "+val, []util.Filter{util.Negate(util.HasFrameMatching(val))})
+			}
+		}
+		if t.prompt != "search" {
+			t.status = fmt.Sprintf("%s %s: %d goroutines", t.prompt, val, len(t.sess.cur()))
+		}
+		t.prompt = ""
+		t.regroup()
+		return
+	case keyEsc, keyCtrlC:
+		if t.prompt == "search" {
+			t.search = ""
+			t.regroup()
+		}
+		t.prompt = ""
+		return
+	case keyBackspace:
+		if rs := []rune(t.input); len(rs) > 0 {
+			t.input = string(rs[:len(rs)-1])
+		}
+	default:
+		if k < ' ' {
+			return
+		}
+		t.input += string(k)
+	}
+
+	// search is incremental, so refresh the list on every keystroke
+	if t.prompt == "search" {
+		t.search = t.input
+		t.regroup()
+	}
+}
+
+// regroup recomputes the left pane from the current filter set, grouping
+// mode and search query.
+func (t *tuiState) regroup() {
+	stacks := t.sess.cur()
+	if t.search != "" {
+		stacks = util.ApplyFilters(stacks, []util.Filter{util.HasFrameMatching(t.search)})
+	}
+
+	var key func(*util.Stack) string
+	switch t.mode {
+	case "summary":
+		key = topFunctionKey
+	case "all":
+		key = func(s *util.Stack) string {
+			return strconv.Itoa(s.Number)
+		}
+	default:
+		key = uniqueKey
+	}
+
+	t.groups = groupStacks(stacks, key)
+	if t.mode != "all" {
+		sort.SliceStable(t.groups, func(i, j int) bool {
+			return len(t.groups[i].Stacks) > len(t.groups[j].Stacks)
+		})
+	}
+
+	t.sel = 0
+	t.top = 0
+	t.scroll = 0
+}
+
+func (t *tuiState) listHeight() int {
+	_, h := t.term.size()
+	// one line each for the header and the status line
+	if h < 3 {
+		return 1
+	}
+	return h - 2
+}
+
+func (t *tuiState) moveTo(i int) {
+	if i >= len(t.groups) {
+		i = len(t.groups) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	if i != t.sel {
+		t.scroll = 0
+	}
+	t.sel = i
+}
+
+func (t *tuiState) groupLabel(g *stackGroup) string {
+	switch t.mode {
+	case "all":
+		return fmt.Sprintf("%d [%s] %s", g.Rep.Number, g.Rep.State, topFunctionKey(g.Rep))
+	default:
+		return fmt.Sprintf("%5d %s", len(g.Stacks), topFunctionKey(g.Rep))
+	}
+}
+
+// detailLines renders the right pane for the selected group.
+func (t *tuiState) detailLines() []string {
+	if len(t.groups) == 0 {
+		return []string{"no matching goroutines"}
+	}
+	g := t.groups[t.sel]
+
+	lines := []string{
+		fmt.Sprintf("count: %d", len(g.Stacks)),
+		"wait " + strings.TrimSpace(compWaitStats(g.Stacks).String()),
+		"",
+	}
+	return append(lines, strings.Split(strings.TrimRight(t.printer.stackString(g.Rep), "\n"), "\n")...)
+}
+
+func (t *tuiState) draw() {
+	w, h := t.term.size()
+	listH := h - 2
+	if listH < 1 {
+		listH = 1
+	}
+
+	leftW := w / 3
+	if leftW > 60 {
+		leftW = 60
+	}
+	rightW := w - leftW - 1
+
+	if t.sel < t.top {
+		t.top = t.sel
+	}
+	if t.sel >= t.top+listH {
+		t.top = t.sel - listH + 1
+	}
+
+	details := t.detailLines()
+	if t.scroll > len(details)-1 {
+		t.scroll = len(details) - 1
+	}
+	details = details[t.scroll:]
+
+	out := t.term.out
+	out.WriteString("\x1b[H")
+
+	header := fmt.Sprintf("stackparse: %d goroutines, %d groups (%s)  %s",
+		len(t.sess.cur()), len(t.groups), t.mode, strings.Join(t.sess.ops, " > "))
+	if t.search != "" {
+		header += "  search: " + t.search
+	}
+	out.WriteString("\x1b[7m" + fit(header, w) + "\x1b[0m\r\n")
+
+	for row := 0; row < listH; row++ {
+		var left string
+		i := t.top + row
+		if i < len(t.groups) {
+			left = fit(t.groupLabel(t.groups[i]), leftW)
+			if i == t.sel {
+				left = "\x1b[7m" + left + "\x1b[0m"
+			}
+		} else {
+			left = fit("", leftW)
+		}
+
+		var right string
+		if row < len(details) {
+			right = fit(details[row], rightW)
+			if t.search != "" && strings.Contains(details[row], t.search) {
+				right = "\x1b[1;33m" + right + "\x1b[0m"
+			}
+		}
+
+		out.WriteString(left + "│" + right + "\x1b[K\r\n")
+	}
+
+	var status string
+	switch {
+	case t.prompt != "":
+		status = t.prompt + ": " + t.input
+	case t.status != "":
+		status = t.status
+	default:
+		status = tuiHelp
+	}
+	out.WriteString(fit(status, w) + "\x1b[K")
+	out.Flush()
+}
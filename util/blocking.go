@@ -0,0 +1,176 @@
+package stacks
+
+// Normalized reasons a goroutine can be blocked for, see Stack.Blocking.
+const (
+	BlockRunning     = "running"
+	BlockMutex       = "mutex"
+	BlockRWMutexRead = "rwmutex-read"
+	BlockWaitGroup   = "waitgroup"
+	BlockCond        = "cond"
+	BlockChanSend    = "chan-send"
+	BlockChanRecv    = "chan-recv"
+	BlockSelect      = "select"
+	BlockNetIO       = "net-io"
+	BlockSyscall     = "syscall"
+	BlockSleep       = "sleep"
+	BlockOther       = "other"
+)
+
+// BlockReasons lists every reason Stack.Blocking can return.
+var BlockReasons = []string{
+	BlockRunning, BlockMutex, BlockRWMutexRead, BlockWaitGroup, BlockCond,
+	BlockChanSend, BlockChanRecv, BlockSelect, BlockNetIO, BlockSyscall,
+	BlockSleep, BlockOther,
+}
+
+// blockingFrames maps the functions a blocked goroutine sits in to the
+// reason it is blocked, for the cases where the state alone is ambiguous
+// (semacquire covers mutexes, wait groups and more).
+var blockingFrames = map[string]string{
+	"sync.(*Mutex).Lock":                BlockMutex,
+	"sync.(*Mutex).lockSlow":            BlockMutex,
+	"sync.(*RWMutex).Lock":              BlockMutex,
+	"sync.(*RWMutex).RLock":             BlockRWMutexRead,
+	"sync.(*WaitGroup).Wait":            BlockWaitGroup,
+	"sync.(*Cond).Wait":                 BlockCond,
+	"runtime.chansend":                  BlockChanSend,
+	"runtime.chansend1":                 BlockChanSend,
+	"runtime.chanrecv":                  BlockChanRecv,
+	"runtime.chanrecv1":                 BlockChanRecv,
+	"runtime.chanrecv2":                 BlockChanRecv,
+	"runtime.selectgo":                  BlockSelect,
+	"runtime.block":                     BlockSelect,
+	"internal/poll.runtime_pollWait":    BlockNetIO,
+	"runtime.netpollblock":              BlockNetIO,
+	"time.Sleep":                        BlockSleep,
+	"runtime.timeSleep":                 BlockSleep,
+	"syscall.Syscall":                   BlockSyscall,
+	"syscall.Syscall6":                  BlockSyscall,
+	"syscall.RawSyscall":                BlockSyscall,
+	"syscall.syscall":                   BlockSyscall,
+	"syscall.syscall6":                  BlockSyscall,
+	"runtime.cgocall":                   BlockSyscall,
+	"internal/runtime/syscall.Syscall6": BlockSyscall,
+	"runtime/internal/syscall.Syscall6": BlockSyscall,
+	"golang.org/x/sys/unix.Syscall":     BlockSyscall,
+	"golang.org/x/sys/unix.Syscall6":    BlockSyscall,
+	"golang.org/x/sys/unix.RawSyscall":  BlockSyscall,
+	"golang.org/x/sys/unix.RawSyscall6": BlockSyscall,
+}
+
+// blockingStates maps goroutine states to the reason they imply, for when
+// the frames don't say.
+var blockingStates = map[string]string{
+	"running":                 BlockRunning,
+	"runnable":                BlockRunning,
+	"syscall":                 BlockSyscall,
+	"select":                  BlockSelect,
+	"select (no cases)":       BlockSelect,
+	"chan send":               BlockChanSend,
+	"chan send (nil chan)":    BlockChanSend,
+	"chan receive":            BlockChanRecv,
+	"chan receive (nil chan)": BlockChanRecv,
+	"IO wait":                 BlockNetIO,
+	"sleep":                   BlockSleep,
+	"sync.Mutex.Lock":         BlockMutex,
+	"sync.RWMutex.Lock":       BlockMutex,
+	"sync.RWMutex.RLock":      BlockRWMutexRead,
+	"sync.WaitGroup.Wait":     BlockWaitGroup,
+	"sync.Cond.Wait":          BlockCond,
+}
+
+// Blocking describes why a goroutine is stopped where it is.
+type Blocking struct {
+	// Reason is one of the Block constants.
+	Reason string
+
+	// Initiator is the innermost frame outside the standard library, i.e.
+	// the user code that ended up blocking. It is nil if every frame is in
+	// the standard library.
+	Initiator *Frame
+}
+
+// Key is a short description of b suitable for grouping goroutines, like
+// "mutex in github.com/a/b.(*T).Method".
+func (b Blocking) Key() string {
+	if b.Initiator == nil {
+		return b.Reason
+	}
+	return b.Reason + " in " + b.Initiator.Function
+}
+
+// Blocking classifies what the goroutine is blocked on. The state string
+// varies between Go versions and is often too vague (semacquire could be a
+// mutex or a wait group), so the frames at the top of the stack are used
+// where they give a clearer answer.
+func (s *Stack) Blocking() Blocking {
+	var b Blocking
+	for i := range s.Frames {
+		if !s.Frames[i].IsStdlib() {
+			b.Initiator = &s.Frames[i]
+			break
+		}
+	}
+
+	// a goroutine that is running isn't blocked, whatever it is in the
+	// middle of
+	state := s.State
+	if state == "running" || state == "runnable" {
+		b.Reason = BlockRunning
+		return b
+	}
+
+	for i := range s.Frames {
+		f := &s.Frames[i]
+		if r, ok := blockingFrames[f.Function]; ok {
+			b.Reason = r
+			return b
+		}
+		// only look through the runtime and standard library machinery
+		// on top of the stack, not what user code called further down
+		if !f.IsStdlib() {
+			break
+		}
+	}
+
+	if r, ok := blockingStates[state]; ok {
+		b.Reason = r
+	} else if r, ok := blockingStates[s.BaseState]; ok {
+		// e.g. "select (scan)", caught mid garbage collection
+		b.Reason = r
+	} else {
+		b.Reason = BlockOther
+	}
+	return b
+}
+
+// IsBlockReason reports whether r is one of the reasons Stack.Blocking can
+// return.
+func IsBlockReason(r string) bool {
+	for _, br := range BlockReasons {
+		if r == br {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchBlockReason returns a filter for stacks blocked for any of the
+// given reasons, see Stack.Blocking.
+func MatchBlockReason(reasons ...string) Filter {
+	return func(s *Stack) bool {
+		r := s.Blocking().Reason
+		for _, reason := range reasons {
+			if r == reason {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// CompBlockReason orders stacks by why they are blocked and then by the
+// user code that blocked, so that similar goroutines end up together.
+func CompBlockReason(a, b *Stack) bool {
+	return a.Blocking().Key() < b.Blocking().Key()
+}
@@ -0,0 +1,53 @@
+package stacks
+
+import "testing"
+
+func TestStackBlocking(t *testing.T) {
+	cases := []struct {
+		state     string
+		functions []string
+		reason    string
+		key       string
+	}{
+		{"semacquire", []string{"sync.runtime_SemacquireMutex", "sync.(*Mutex).lockSlow", "sync.(*Mutex).Lock", "main.(*cache).get"}, BlockMutex, "mutex in main.(*cache).get"},
+		{"semacquire", []string{"sync.runtime_Semacquire", "sync.(*WaitGroup).Wait", "main.main"}, BlockWaitGroup, "waitgroup in main.main"},
+		{"semacquire", []string{"sync.runtime_SemacquireRWMutexR", "sync.(*RWMutex).RLock", "main.read"}, BlockRWMutexRead, "rwmutex-read in main.read"},
+		{"sync.Cond.Wait", []string{"sync.runtime_notifyListWait", "sync.(*Cond).Wait", "main.worker"}, BlockCond, "cond in main.worker"},
+		{"chan receive", []string{"runtime.gopark", "runtime.chanrecv", "runtime.chanrecv1", "main.worker"}, BlockChanRecv, "chan-recv in main.worker"},
+		{"chan send (nil chan)", []string{"runtime.gopark", "main.leak"}, BlockChanSend, "chan-send in main.leak"},
+		{"select", []string{"runtime.gopark", "runtime.selectgo", "net/http.(*persistConn).writeLoop"}, BlockSelect, "select"},
+		{"IO wait", []string{"internal/poll.runtime_pollWait", "internal/poll.(*pollDesc).wait", "net.(*conn).Read", "main.handle"}, BlockNetIO, "net-io in main.handle"},
+		{"sleep", []string{"time.Sleep", "main.poll"}, BlockSleep, "sleep in main.poll"},
+		{"syscall", []string{"syscall.Syscall", "syscall.read", "os.(*File).Read", "main.main"}, BlockSyscall, "syscall in main.main"},
+		{"running", []string{"sync.(*Mutex).Lock", "main.main"}, BlockRunning, "running in main.main"},
+		// a sync.Once further down isn't what this goroutine is waiting on
+		{"select", []string{"runtime.gopark", "runtime.selectgo", "main.run", "sync.(*Once).Do"}, BlockSelect, "select in main.run"},
+		{"GC worker (idle)", []string{"runtime.gopark", "runtime.gcBgMarkWorker"}, BlockOther, "other"},
+	}
+
+	for _, c := range cases {
+		s := &Stack{State: c.state}
+		for _, fn := range c.functions {
+			s.Frames = append(s.Frames, Frame{Function: fn})
+		}
+
+		b := s.Blocking()
+		if b.Reason != c.reason {
+			t.Errorf("%s %v: expected reason %q, got %q", c.state, c.functions, c.reason, b.Reason)
+		}
+		if got := b.Key(); got != c.key {
+			t.Errorf("%s %v: expected key %q, got %q", c.state, c.functions, c.key, got)
+		}
+	}
+}
+
+func TestMatchBlockReason(t *testing.T) {
+	wg := &Stack{State: "semacquire", Frames: []Frame{{Function: "sync.runtime_Semacquire"}, {Function: "sync.(*WaitGroup).Wait"}, {Function: "main.main"}}}
+	sys := &Stack{State: "syscall", Frames: []Frame{{Function: "syscall.Syscall"}, {Function: "main.read"}}}
+	sleep := &Stack{State: "sleep", Frames: []Frame{{Function: "time.Sleep"}, {Function: "main.poll"}}}
+
+	got := ApplyFilters([]*Stack{wg, sys, sleep}, []Filter{MatchBlockReason(BlockWaitGroup, BlockSyscall)})
+	if len(got) != 2 || got[0] != wg || got[1] != sys {
+		t.Fatalf("expected the waitgroup and syscall stacks, got %v", got)
+	}
+}
@@ -0,0 +1,113 @@
+package stacks
+
+import "strings"
+
+// stdlibRoots are the top level directories of the standard library. Frames
+// whose package falls under one of these are considered stdlib rather than
+// user code.
+var stdlibRoots = map[string]bool{
+	"archive":   true,
+	"arena":     true,
+	"bufio":     true,
+	"builtin":   true,
+	"bytes":     true,
+	"cmp":       true,
+	"compress":  true,
+	"container": true,
+	"context":   true,
+	"crypto":    true,
+	"database":  true,
+	"debug":     true,
+	"embed":     true,
+	"encoding":  true,
+	"errors":    true,
+	"expvar":    true,
+	"flag":      true,
+	"fmt":       true,
+	"go":        true,
+	"hash":      true,
+	"html":      true,
+	"image":     true,
+	"index":     true,
+	"internal":  true,
+	"io":        true,
+	"iter":      true,
+	"log":       true,
+	"maps":      true,
+	"math":      true,
+	"mime":      true,
+	"net":       true,
+	"os":        true,
+	"path":      true,
+	"plugin":    true,
+	"reflect":   true,
+	"regexp":    true,
+	"runtime":   true,
+	"slices":    true,
+	"sort":      true,
+	"strconv":   true,
+	"strings":   true,
+	"structs":   true,
+	"sync":      true,
+	"syscall":   true,
+	"testing":   true,
+	"text":      true,
+	"time":      true,
+	"unicode":   true,
+	"unique":    true,
+	"unsafe":    true,
+	"uuid":      true,
+	"vendor":    true,
+	"weak":      true,
+}
+
+// Package returns the import path of the package the frame's function
+// belongs to, e.g. "github.com/a/b" for "github.com/a/b.(*T).Method".
+func (f *Frame) Package() string {
+	return functionPackage(f.Function)
+}
+
+func functionPackage(fn string) string {
+	// type parameters may contain dots and slashes of their own
+	if n := strings.IndexByte(fn, '['); n >= 0 {
+		fn = fn[:n]
+	}
+	slash := strings.LastIndexByte(fn, '/')
+	dot := strings.IndexByte(fn[slash+1:], '.')
+	if dot < 0 {
+		return ""
+	}
+	return fn[:slash+1+dot]
+}
+
+// IsStdlib reports whether the frame is in a standard library package,
+// including the runtime.
+func (f *Frame) IsStdlib() bool {
+	return IsStdlibPackage(f.Package())
+}
+
+// IsStdlibPackage reports whether the import path is part of the standard
+// library. Packages vendored into the standard library count as stdlib.
+func IsStdlibPackage(pkg string) bool {
+	if pkg == "" {
+		return false
+	}
+	root := pkg
+	if n := strings.IndexByte(pkg, '/'); n >= 0 {
+		root = pkg[:n]
+	}
+	return stdlibRoots[root]
+}
+
+// IsRuntime reports whether the frame is in the runtime itself, as opposed
+// to the rest of the standard library.
+func (f *Frame) IsRuntime() bool {
+	pkg := f.Package()
+	return pkg == "runtime" || strings.HasPrefix(pkg, "runtime/internal/") || strings.HasPrefix(pkg, "internal/runtime/")
+}
+
+// IsVendored reports whether the frame's file is in a vendor directory.
+func (f *Frame) IsVendored() bool {
+	file := strings.Replace(f.File, "\\", "/", -1)
+	return strings.Contains(file, "/vendor/") || strings.HasPrefix(file, "vendor/")
+}
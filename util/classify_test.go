@@ -0,0 +1,71 @@
+package stacks
+
+import "testing"
+
+func TestFramePackage(t *testing.T) {
+	cases := []struct {
+		function string
+		pkg      string
+		stdlib   bool
+	}{
+		{"runtime.gopark", "runtime", true},
+		{"sync.(*WaitGroup).Wait", "sync", true},
+		{"net/http.(*conn).serve", "net/http", true},
+		{"internal/poll.(*FD).Read", "internal/poll", true},
+		{"vendor/golang.org/x/net/http2.(*Framer).ReadFrame", "vendor/golang.org/x/net/http2", true},
+		{"main.main", "main", false},
+		{"github.com/libp2p/go-libp2p-swarm.(*Swarm).notifyAll", "github.com/libp2p/go-libp2p-swarm", false},
+		{"github.com/a/b.Map[go.shape.string,github.com/c/d.T].Get", "github.com/a/b", false},
+		{"mycompany/internal/thing.Run", "mycompany/internal/thing", false},
+	}
+
+	for _, c := range cases {
+		f := &Frame{Function: c.function}
+		if got := f.Package(); got != c.pkg {
+			t.Errorf("%s: expected package %q, got %q", c.function, c.pkg, got)
+		}
+		if got := f.IsStdlib(); got != c.stdlib {
+			t.Errorf("%s: expected stdlib %v, got %v", c.function, c.stdlib, got)
+		}
+	}
+}
+
+func TestFrameIsVendored(t *testing.T) {
+	cases := []struct {
+		file     string
+		vendored bool
+	}{
+		{"/build/src/github.com/me/app/vendor/github.com/x/y/z.go", true},
+		{"vendor/github.com/x/y/z.go", true},
+		{"/go/pkg/mod/github.com/x/y@v1.2.3/z.go", false},
+		{"/build/src/github.com/me/vendorlib/z.go", false},
+	}
+
+	for _, c := range cases {
+		f := &Frame{File: c.file}
+		if got := f.IsVendored(); got != c.vendored {
+			t.Errorf("%s: expected vendored %v, got %v", c.file, c.vendored, got)
+		}
+	}
+}
+
+func TestFrameIsRuntime(t *testing.T) {
+	cases := []struct {
+		function string
+		runtime  bool
+	}{
+		{"runtime.gopark", true},
+		{"runtime/internal/atomic.Load", true},
+		{"internal/runtime/maps.(*Map).Get", true},
+		{"runtime/pprof.Do", false},
+		{"sync.runtime_Semacquire", false},
+		{"main.main", false},
+	}
+
+	for _, c := range cases {
+		f := &Frame{Function: c.function}
+		if got := f.IsRuntime(); got != c.runtime {
+			t.Errorf("%s: expected runtime %v, got %v", c.function, c.runtime, got)
+		}
+	}
+}
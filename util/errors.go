@@ -0,0 +1,80 @@
+package stacks
+
+import "fmt"
+
+// ParseErrorKind classifies what was wrong with the input.
+type ParseErrorKind int
+
+const (
+	// ErrHeader is a "goroutine N [state]:" line that couldn't be parsed.
+	ErrHeader ParseErrorKind = iota + 1
+	// ErrFileLine is a malformed file:line line following a frame.
+	ErrFileLine
+	// ErrMissingFileLine is a frame or created by line with no file:line
+	// after it, e.g. because the dump was truncated.
+	ErrMissingFileLine
+	// ErrCreatedBy is a malformed "created by" line.
+	ErrCreatedBy
+	// ErrOrphanLine is a line outside of any goroutine.
+	ErrOrphanLine
+	// ErrRead is a failure reading the input, including lines too long to
+	// be a goroutine dump.
+	ErrRead
+	// ErrPanic is a bug in the parser.
+	ErrPanic
+	// ErrFrame is a line in the middle of a goroutine that isn't a
+	// function call, such as a log line or a call cut short.
+	ErrFrame
+)
+
+func (k ParseErrorKind) String() string {
+	switch k {
+	case ErrHeader:
+		return "malformed goroutine header"
+	case ErrFileLine:
+		return "malformed file:line"
+	case ErrMissingFileLine:
+		return "missing file:line"
+	case ErrCreatedBy:
+		return "malformed created by"
+	case ErrOrphanLine:
+		return "line is not part of a goroutine"
+	case ErrRead:
+		return "read error"
+	case ErrPanic:
+		return "parser panic"
+	case ErrFrame:
+		return "malformed frame"
+	default:
+		return fmt.Sprintf("ParseErrorKind(%d)", int(k))
+	}
+}
+
+// ParseError is the error returned for input that can't be parsed. The
+// stacks parsed before the error are returned alongside it, so callers can
+// decide whether they're good enough to go on with.
+type ParseError struct {
+	Kind ParseErrorKind
+
+	// Line is the 1-based line number of the offending line, and Offset
+	// the byte offset of its start in the input.
+	Line   int
+	Offset int64
+
+	// Text is the offending line, with any prefix trimmed off.
+	Text string
+
+	Err error
+
+	// Trace is the parser's own stack trace for ErrPanic, to include in a
+	// bug report.
+	Trace []byte
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,90 @@
+package stacks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseHeader parses a "goroutine N [state, ...]:" line into a Stack with no
+// frames. Besides the state it understands the wait time, "locked to
+// thread" and the gp=, m= and mp= fields printed before the state by
+// GOTRACEBACK=system and crashes since Go 1.23. Any other fields and
+// attributes are kept in Fields and Attrs rather than rejected, since new
+// Go releases add them from time to time.
+func ParseHeader(line string) (*Stack, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(line), "goroutine ")
+	open := strings.IndexByte(rest, '[')
+	end := strings.LastIndexByte(rest, ']')
+	if open < 0 || end < open {
+		return nil, fmt.Errorf("unexpected formatting: %s", line)
+	}
+
+	fields := strings.Fields(rest[:open])
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("unexpected formatting: %s", line)
+	}
+	num, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected formatting: %s", line)
+	}
+
+	s := &Stack{Number: num}
+	for _, f := range fields[1:] {
+		switch {
+		case strings.HasPrefix(f, "gp="):
+			s.GP = f[len("gp="):]
+		case strings.HasPrefix(f, "m="):
+			s.M = f[len("m="):]
+		case strings.HasPrefix(f, "mp="):
+			s.MP = f[len("mp="):]
+		default:
+			s.Fields = append(s.Fields, f)
+		}
+	}
+
+	// The first attribute is always the state, the rest (wait time and
+	// whether it's locked to a thread, usually) may each be omitted.
+	attrs := strings.Split(rest[open+1:end], ", ")
+	s.State = attrs[0]
+	for _, a := range attrs[1:] {
+		if a == "locked to thread" {
+			s.ThreadLocked = true
+			continue
+		}
+		if d, ok := parseWaitTime(a); ok {
+			s.WaitTime = d
+			continue
+		}
+		s.Attrs = append(s.Attrs, a)
+	}
+	s.setStateInfo()
+	return s, nil
+}
+
+// parseWaitTime parses the "N minutes" attribute.
+func parseWaitTime(a string) (time.Duration, bool) {
+	parts := strings.Fields(a)
+	if len(parts) != 2 || (parts[1] != "minutes" && parts[1] != "minute") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * time.Minute, true
+}
+
+// setStateInfo fills in BaseState and StateQualifier from State, splitting
+// off a trailing parenthesized qualifier such as "(nil chan)".
+func (s *Stack) setStateInfo() {
+	s.BaseState, s.StateQualifier = s.State, ""
+	if !strings.HasSuffix(s.State, ")") {
+		return
+	}
+	if n := strings.LastIndex(s.State, " ("); n > 0 {
+		s.BaseState = s.State[:n]
+		s.StateQualifier = s.State[n+2 : len(s.State)-1]
+	}
+}
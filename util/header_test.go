@@ -0,0 +1,76 @@
+package stacks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHeader(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected Stack
+	}{
+		{
+			line:     "goroutine 1 [running]:",
+			expected: Stack{Number: 1, State: "running", BaseState: "running"},
+		},
+		{
+			line: "goroutine 18 [syscall, 3 minutes, locked to thread]:",
+			expected: Stack{Number: 18, State: "syscall", BaseState: "syscall",
+				WaitTime: 3 * time.Minute, ThreadLocked: true},
+		},
+		{
+			line: "goroutine 40 [chan receive (nil chan), 1 minutes]:",
+			expected: Stack{Number: 40, State: "chan receive (nil chan)", BaseState: "chan receive",
+				StateQualifier: "nil chan", WaitTime: time.Minute},
+		},
+		{
+			line: "goroutine 7 [GC worker (idle)]:",
+			expected: Stack{Number: 7, State: "GC worker (idle)", BaseState: "GC worker",
+				StateQualifier: "idle"},
+		},
+		{
+			line: "goroutine 1 gp=0xc000002380 m=0 mp=0x5d8540 [running]:",
+			expected: Stack{Number: 1, State: "running", BaseState: "running",
+				GP: "0xc000002380", M: "0", MP: "0x5d8540"},
+		},
+		{
+			line: "goroutine 6 gp=0xc000007a40 m=nil [select, 2 minutes, synctest group 5]:",
+			expected: Stack{Number: 6, State: "select", BaseState: "select",
+				GP: "0xc000007a40", M: "nil", WaitTime: 2 * time.Minute, Attrs: []string{"synctest group 5"}},
+		},
+		{
+			// fields and attributes from future releases stay where they were
+			line: "goroutine 9 gp=0xc000007a40 foo=bar [select, baz]:",
+			expected: Stack{Number: 9, State: "select", BaseState: "select",
+				GP: "0xc000007a40", Fields: []string{"foo=bar"}, Attrs: []string{"baz"}},
+		},
+	}
+
+	for _, c := range cases {
+		s, err := ParseHeader(c.line)
+		if err != nil {
+			t.Errorf("%s: %s", c.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(*s, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.line, c.expected, *s)
+		}
+		if got := s.Header(); got != c.line {
+			t.Errorf("expected header to round trip as %q, got %q", c.line, got)
+		}
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	for _, line := range []string{
+		"goroutine",
+		"goroutine x [running]:",
+		"goroutine 1 running",
+	} {
+		if _, err := ParseHeader(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package stacks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JSONSchemaVersion is the version of the JSON encoding of Stack. The field
+// names of Stack, Frame and CreatedBy make up the schema; it is bumped on
+// any change that older readers couldn't cope with.
+const JSONSchemaVersion = 1
+
+// ErrNotStackJSON is returned when reading JSON that isn't stacks written
+// by stackparse, such as its summary output or unrelated JSON logs.
+var ErrNotStackJSON = errors.New("not stackparse JSON")
+
+// stackAlias has the fields of Stack but not its methods, so it can be
+// encoded without recursing into MarshalJSON.
+type stackAlias Stack
+
+type jsonStack struct {
+	Schema int
+	*stackAlias
+}
+
+func (s *Stack) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonStack{
+		Schema:     JSONSchemaVersion,
+		stackAlias: (*stackAlias)(s),
+	})
+}
+
+func (s *Stack) UnmarshalJSON(data []byte) error {
+	// Any object would otherwise decode as an empty stack. Output from
+	// before the schema was versioned always has Number and Frames.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return ErrNotStackJSON
+		}
+		return err
+	}
+	_, schema := fields["Schema"]
+	_, number := fields["Number"]
+	_, frames := fields["Frames"]
+	if !schema && !(number && frames) {
+		return ErrNotStackJSON
+	}
+
+	js := jsonStack{stackAlias: (*stackAlias)(s)}
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	// Output from before the schema was versioned is otherwise the same
+	// as version 1.
+	if js.Schema > JSONSchemaVersion {
+		return fmt.Errorf("unsupported stack schema version %d (newest supported is %d)", js.Schema, JSONSchemaVersion)
+	}
+	if s.BaseState == "" {
+		s.setStateInfo()
+	}
+	return nil
+}
+
+// ReadJSONStacks reads stacks written as JSON, either as a single array or
+// as a stream of objects such as newline delimited JSON. It returns an
+// error wrapping ErrNotStackJSON for JSON that isn't stacks.
+func ReadJSONStacks(r io.Reader) ([]*Stack, error) {
+	br := bufio.NewReader(r)
+	c, err := peekNonSpace(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	dec := json.NewDecoder(br)
+	if c == '[' {
+		var stacks []*Stack
+		if err := dec.Decode(&stacks); err != nil {
+			return nil, err
+		}
+		return stacks, nil
+	}
+
+	var stacks []*Stack
+	for {
+		s := new(Stack)
+		if err := dec.Decode(s); err != nil {
+			if err == io.EOF {
+				return stacks, nil
+			}
+			return nil, fmt.Errorf("stack %d: %w", len(stacks)+1, err)
+		}
+		stacks = append(stacks, s)
+	}
+}
+
+// peekNonSpace returns the first byte of br that isn't whitespace, without
+// consuming anything.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for i := 1; i <= br.Size(); i++ {
+		b, err := br.Peek(i)
+		if err != nil {
+			return 0, err
+		}
+		switch c := b[i-1]; c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c, nil
+		}
+	}
+	return 0, io.EOF
+}
@@ -0,0 +1,116 @@
+package stacks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	stacks, err := ParseStacks(strings.NewReader(simplifyInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stacks = append(stacks, stacks[0].CollapseStdlib())
+	stacks[1].WaitTime = 25 * 60 * 1e9
+	stacks[1].ThreadLocked = true
+
+	t.Run("array", func(t *testing.T) {
+		data, err := json.Marshal(stacks)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ParseStacks(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, stacks) {
+			t.Fatalf("round trip mismatch:\n%s", data)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, s := range stacks {
+			if err := enc.Encode(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := ParseStacks(&buf, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, stacks) {
+			t.Fatal("round trip mismatch")
+		}
+	})
+}
+
+func TestJSONSchemaVersion(t *testing.T) {
+	data, err := json.Marshal(&Stack{Number: 1, State: "running"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(`{"Schema":1,`)) {
+		t.Fatalf("expected the schema version first, got %s", data)
+	}
+
+	// output from before the schema was versioned
+	legacy := `[{"Number":1,"State":"running","WaitTime":0,"Frames":null,"ThreadLocked":false,"CreatedBy":{"Function":"","File":"","Line":0,"Entry":0},"FramesElided":false}]`
+	stacks, err := ReadJSONStacks(strings.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 || stacks[0].Number != 1 || stacks[0].State != "running" {
+		t.Fatalf("unexpected stacks from legacy JSON: %v", stacks)
+	}
+
+	if _, err := ReadJSONStacks(strings.NewReader(`{"Schema":99,"Number":1}`)); err == nil {
+		t.Fatal("expected an error for a newer schema version")
+	}
+}
+
+func TestReadJSONNotStacks(t *testing.T) {
+	for _, input := range []string{
+		`{"Count":3,"Function":"main.main"}`,
+		`{"ts":1,"msg":"goroutine 1 [running]:"}`,
+		`[{"Count":3}]`,
+		`[1, 2]`,
+	} {
+		if _, err := ReadJSONStacks(strings.NewReader(input)); !errors.Is(err, ErrNotStackJSON) {
+			t.Errorf("%s: expected ErrNotStackJSON, got %v", input, err)
+		}
+	}
+}
+
+func TestParseJSONLikeInput(t *testing.T) {
+	// a dump whose line prefix starts with a bracket isn't JSON
+	prefixed := "[app] goroutine 1 [running]:\n[app] main.main()\n[app] \t/x/main.go:10 +0x1\n"
+	stacks, err := ParseStacks(strings.NewReader(prefixed), `^\[app\] `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 || stacks[0].Frames[0].File != "/x/main.go" {
+		t.Fatalf("unexpected stacks: %v", stacks)
+	}
+
+	data, err := json.Marshal(stacks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stacks, err = ParseStacksWithOptions(bytes.NewReader(data), ParseOptions{
+		PathRewrites: []PathRewrite{{From: "/x/", To: "/src/"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 || stacks[0].Frames[0].File != "/src/main.go" {
+		t.Fatalf("expected path rewrites to apply to JSON input, got %v", stacks)
+	}
+}
@@ -0,0 +1,75 @@
+package stacks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// jsonFieldReader reads the text of one field out of JSON log lines.
+type jsonFieldReader struct {
+	br   *bufio.Reader
+	path []string
+	buf  []byte
+	err  error
+}
+
+// NewJSONFieldReader returns a reader of the text in a field of each JSON
+// object in r, one per line, for logs that are shipped as JSON. The field
+// is given as a dot separated path, like "msg" or "error.stack", and may
+// hold a single line of a dump or a whole one with embedded newlines.
+// Lines that aren't JSON objects or don't have the field as a string are
+// skipped, so line numbers in errors are of the extracted text.
+func NewJSONFieldReader(r io.Reader, path string) io.Reader {
+	return &jsonFieldReader{
+		br:   bufio.NewReader(r),
+		path: strings.Split(path, "."),
+	}
+}
+
+func (j *jsonFieldReader) Read(p []byte) (int, error) {
+	for len(j.buf) == 0 {
+		if j.err != nil {
+			return 0, j.err
+		}
+
+		line, err := j.br.ReadBytes('\n')
+		if text, ok := jsonField(line, j.path); ok {
+			j.buf = append(j.buf, text...)
+			if !strings.HasSuffix(text, "\n") {
+				j.buf = append(j.buf, '\n')
+			}
+		}
+		j.err = err
+	}
+
+	n := copy(p, j.buf)
+	j.buf = j.buf[n:]
+	return n, nil
+}
+
+// jsonField returns the string at path in the JSON object in line.
+func jsonField(line []byte, path []string) (string, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return "", false
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(line, &v); err != nil {
+		return "", false
+	}
+	for _, k := range path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = obj[k]; !ok {
+			return "", false
+		}
+	}
+	s, ok := v.(string)
+	return s, ok
+}
@@ -0,0 +1,45 @@
+package stacks
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestJSONFieldReader(t *testing.T) {
+	perLine := `{"ts":1,"msg":"goroutine 1 [running]:"}
+{"ts":2,"msg":"main.main()"}
+not json at all
+{"ts":3,"level":"info"}
+{"ts":4,"msg":"\t/x/main.go:10 +0x1"}
+{"ts":5,"msg":""}
+`
+	whole := `{"level":"error","error":{"stack":"goroutine 1 [running]:\nmain.main()\n\t/x/main.go:10 +0x1\n"}}` + "\n"
+
+	expected := "goroutine 1 [running]:\nmain.main()\n\t/x/main.go:10 +0x1\n\n"
+	for _, c := range []struct {
+		input string
+		path  string
+		want  string
+	}{
+		{perLine, "msg", expected},
+		{whole, "error.stack", "goroutine 1 [running]:\nmain.main()\n\t/x/main.go:10 +0x1\n"},
+		{whole, "error.missing", ""},
+	} {
+		got, err := ioutil.ReadAll(NewJSONFieldReader(strings.NewReader(c.input), c.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: expected %q, got %q", c.path, c.want, got)
+		}
+	}
+
+	stacks, err := ParseStacksWithOptions(strings.NewReader(perLine), ParseOptions{JSONField: "msg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 || stacks[0].Frames[0].Line != 10 {
+		t.Fatalf("unexpected stacks: %v", stacks)
+	}
+}
@@ -0,0 +1,124 @@
+package stacks
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LinkTemplate produces source links for modules whose path starts with
+// Prefix. The template may refer to {module}, {version}, {ref}, {file} and
+// {line}, where ref is the git ref the version corresponds to (a commit
+// hash for pseudo-versions, the tag otherwise).
+type LinkTemplate struct {
+	Prefix   string
+	Template string
+}
+
+// ParseLinkTemplate parses a template of the form "prefix=template".
+func ParseLinkTemplate(s string) (LinkTemplate, error) {
+	rw, err := ParsePathRewrite(s)
+	if err != nil {
+		return LinkTemplate{}, err
+	}
+	return LinkTemplate{
+		Prefix:   rw.From,
+		Template: rw.To,
+	}, nil
+}
+
+// Linker builds links to the exact line of a frame on its code host.
+type Linker struct {
+	// Templates are consulted before the built in hosts.
+	Templates []LinkTemplate
+
+	// GoVersion is the release tag, e.g. go1.16.3, used for links into
+	// the standard library.
+	GoVersion string
+}
+
+// URL returns a link to the frame's source, or "" if none can be made.
+func (l *Linker) URL(f *Frame) string {
+	line := strconv.FormatInt(f.Line, 10)
+
+	if f.ModulePath == "" {
+		if f.RelFile != "" && f.IsStdlib() && l.GoVersion != "" {
+			return "https://github.com/golang/go/blob/" + l.GoVersion + "/src/" + f.RelFile + "#L" + line
+		}
+		return ""
+	}
+
+	ref := versionRef(f.ModuleVersion)
+	for _, t := range l.Templates {
+		if strings.HasPrefix(f.ModulePath, t.Prefix) {
+			return strings.NewReplacer(
+				"{module}", f.ModulePath,
+				"{version}", f.ModuleVersion,
+				"{ref}", ref,
+				"{file}", f.RelFile,
+				"{line}", line,
+			).Replace(t.Template)
+		}
+	}
+
+	parts := strings.Split(f.ModulePath, "/")
+	var repo, blob string
+	switch {
+	case parts[0] == "golang.org" && len(parts) >= 3 && parts[1] == "x":
+		repo, blob = "https://github.com/golang/"+parts[2], "/blob/"
+		parts = append([]string{"github.com", "golang"}, parts[2:]...)
+	case parts[0] == "github.com" && len(parts) >= 3:
+		repo, blob = "https://"+strings.Join(parts[:3], "/"), "/blob/"
+	case parts[0] == "gitlab.com" && len(parts) >= 3:
+		repo, blob = "https://"+strings.Join(parts[:3], "/"), "/-/blob/"
+	case parts[0] == "bitbucket.org" && len(parts) >= 3:
+		repo, blob = "https://"+strings.Join(parts[:3], "/"), "/src/"
+	default:
+		return ""
+	}
+
+	// Modules in a subdirectory of their repo are tagged as dir/version,
+	// but a trailing major version suffix is not a directory.
+	sub := parts[3:]
+	if len(sub) > 0 && isMajorVersion(sub[len(sub)-1]) {
+		sub = sub[:len(sub)-1]
+	}
+	dir := strings.Join(sub, "/")
+	if dir != "" {
+		if !isPseudoVersion(f.ModuleVersion) {
+			ref = dir + "/" + ref
+		}
+		dir += "/"
+	}
+
+	return repo + blob + ref + "/" + dir + f.RelFile + "#L" + line
+}
+
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+// isPseudoVersion reports whether v looks like v0.0.0-20191109021931-daa7c04131f5.
+func isPseudoVersion(v string) bool {
+	v = strings.TrimSuffix(v, "+incompatible")
+	parts := strings.Split(v, "-")
+	if len(parts) < 3 {
+		return false
+	}
+	stamp := parts[len(parts)-2]
+	if n := strings.LastIndexByte(stamp, '.'); n >= 0 {
+		stamp = stamp[n+1:]
+	}
+	return len(stamp) == 14 && len(parts[len(parts)-1]) == 12
+}
+
+// versionRef returns the git ref a module version was built from.
+func versionRef(v string) string {
+	if isPseudoVersion(v) {
+		return v[strings.LastIndexByte(v, '-')+1:]
+	}
+	return strings.TrimSuffix(v, "+incompatible")
+}
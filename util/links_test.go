@@ -0,0 +1,88 @@
+package stacks
+
+import "testing"
+
+func TestLinkerURL(t *testing.T) {
+	l := &Linker{
+		GoVersion: "go1.16.3",
+		Templates: []LinkTemplate{
+			{Prefix: "git.corp.example/", Template: "https://git.corp.example/{module}/src/{ref}/{file}#L{line}"},
+		},
+	}
+
+	cases := []struct {
+		function string
+		file     string
+		line     int64
+		expected string
+	}{
+		{
+			function: "github.com/libp2p/go-libp2p-swarm.(*Swarm).notifyAll",
+			file:     "pkg/mod/github.com/libp2p/go-libp2p-swarm@v0.5.3/swarm.go",
+			line:     553,
+			expected: "https://github.com/libp2p/go-libp2p-swarm/blob/v0.5.3/swarm.go#L553",
+		},
+		{
+			function: "github.com/x/y/v2.F",
+			file:     "/go/pkg/mod/github.com/x/y/v2@v2.1.0/z.go",
+			line:     10,
+			expected: "https://github.com/x/y/blob/v2.1.0/z.go#L10",
+		},
+		{
+			function: "github.com/x/y/sub.F",
+			file:     "/go/pkg/mod/github.com/x/y/sub@v1.0.0/z.go",
+			line:     10,
+			expected: "https://github.com/x/y/blob/sub/v1.0.0/sub/z.go#L10",
+		},
+		{
+			function: "github.com/x/y.F",
+			file:     "/go/pkg/mod/github.com/x/y@v0.0.0-20191109021931-daa7c04131f5/z.go",
+			line:     10,
+			expected: "https://github.com/x/y/blob/daa7c04131f5/z.go#L10",
+		},
+		{
+			function: "golang.org/x/net/http2.(*Framer).ReadFrame",
+			file:     "/go/pkg/mod/golang.org/x/net@v0.1.0/http2/frame.go",
+			line:     237,
+			expected: "https://github.com/golang/net/blob/v0.1.0/http2/frame.go#L237",
+		},
+		{
+			function: "gitlab.com/a/b.F",
+			file:     "/go/pkg/mod/gitlab.com/a/b@v1.0.0/c.go",
+			line:     1,
+			expected: "https://gitlab.com/a/b/-/blob/v1.0.0/c.go#L1",
+		},
+		{
+			function: "git.corp.example/team/svc.F",
+			file:     "/go/pkg/mod/git.corp.example/team/svc@v1.4.0/svc.go",
+			line:     7,
+			expected: "https://git.corp.example/git.corp.example/team/svc/src/v1.4.0/svc.go#L7",
+		},
+		{
+			function: "sync.(*WaitGroup).Wait",
+			file:     "/usr/local/go/src/sync/waitgroup.go",
+			line:     130,
+			expected: "https://github.com/golang/go/blob/go1.16.3/src/sync/waitgroup.go#L130",
+		},
+		{
+			function: "main.main",
+			file:     "/build/main.go",
+			line:     1,
+			expected: "",
+		},
+		{
+			function: "example.com/unknown.F",
+			file:     "/go/pkg/mod/example.com/unknown@v1.0.0/f.go",
+			line:     1,
+			expected: "",
+		},
+	}
+
+	for _, c := range cases {
+		f := &Frame{Function: c.function, File: c.file, Line: c.line}
+		f.setModuleInfo()
+		if got := l.URL(f); got != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.file, c.expected, got)
+		}
+	}
+}
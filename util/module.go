@@ -0,0 +1,124 @@
+package stacks
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathRewrite replaces the prefix From of a frame's file with To, e.g. to
+// map a CI build root onto a local checkout.
+type PathRewrite struct {
+	From string
+	To   string
+}
+
+// ParsePathRewrite parses a rewrite rule of the form "from=to".
+func ParsePathRewrite(s string) (PathRewrite, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return PathRewrite{}, fmt.Errorf("path rewrite must be of the form from=to: %q", s)
+	}
+	return PathRewrite{
+		From: parts[0],
+		To:   parts[1],
+	}, nil
+}
+
+func rewritePath(file string, rules []PathRewrite) string {
+	for _, r := range rules {
+		if strings.HasPrefix(file, r.From) {
+			return r.To + file[len(r.From):]
+		}
+	}
+	return file
+}
+
+// rewritePaths applies rules to the files of s's frames and creator, for
+// stacks that weren't parsed from a dump, such as ones read from JSON.
+func (s *Stack) rewritePaths(rules []PathRewrite) {
+	for i := range s.Frames {
+		f := &s.Frames[i]
+		if file := rewritePath(f.File, rules); file != f.File {
+			f.File = file
+			f.setModuleInfo()
+		}
+	}
+	s.CreatedBy.File = rewritePath(s.CreatedBy.File, rules)
+}
+
+// setModuleInfo fills in the fields derived from the frame's file.
+func (f *Frame) setModuleInfo() {
+	f.ModulePath, f.ModuleVersion, f.RelFile = "", "", ""
+
+	file := strings.Replace(f.File, "\\", "/", -1)
+
+	// pkg/mod/github.com/x/y@v1.2.3/z.go
+	if n := strings.LastIndex(file, "pkg/mod/"); n == 0 || (n > 0 && file[n-1] == '/') {
+		rest := file[n+len("pkg/mod/"):]
+		at := strings.IndexByte(rest, '@')
+		if at > 0 {
+			slash := strings.IndexByte(rest[at:], '/')
+			if slash > 0 {
+				f.ModulePath = unescapeModulePath(rest[:at])
+				f.ModuleVersion = rest[at+1 : at+slash]
+				f.RelFile = rest[at+slash+1:]
+				return
+			}
+		}
+	}
+
+	// GOPATH, vendor directories and GOROOT lay packages out by import path,
+	// so the file's directory ends with the package of its function.
+	dir, base := path.Split(file)
+	dir = strings.TrimSuffix(dir, "/")
+	if pkg := f.Package(); pkg != "" && pkg != "main" {
+		if dir == pkg || strings.HasSuffix(dir, "/"+pkg) {
+			f.RelFile = pkg + "/" + base
+			return
+		}
+	}
+
+	// Some runtime functions are linknamed into other packages, e.g.
+	// sync.runtime_Semacquire lives in runtime/sema.go.
+	if f.IsStdlib() {
+		if n := strings.LastIndex(file, "/src/"); n >= 0 {
+			f.RelFile = file[n+len("/src/"):]
+		}
+	}
+}
+
+// unescapeModulePath undoes the module cache's case encoding, where upper
+// case letters are stored as '!' followed by the lower case letter.
+func unescapeModulePath(p string) string {
+	if !strings.Contains(p, "!") {
+		return p
+	}
+	sb := strings.Builder{}
+	upper := false
+	for _, r := range p {
+		switch {
+		case r == '!':
+			upper = true
+		case upper:
+			sb.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// Location returns a description of where the frame is that doesn't depend
+// on the machine it was built on, e.g. "github.com/x/y@v1.2.3 z.go:10".
+func (f *Frame) Location() string {
+	switch {
+	case f.ModulePath != "":
+		return fmt.Sprintf("%s@%s %s:%d", f.ModulePath, f.ModuleVersion, f.RelFile, f.Line)
+	case f.RelFile != "":
+		return fmt.Sprintf("%s:%d", f.RelFile, f.Line)
+	default:
+		return fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+}
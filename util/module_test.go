@@ -0,0 +1,95 @@
+package stacks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFrameModuleInfo(t *testing.T) {
+	cases := []struct {
+		function string
+		file     string
+
+		modulePath    string
+		moduleVersion string
+		relFile       string
+		location      string
+	}{
+		{
+			function:      "github.com/x/y/sub.F",
+			file:          "/go/pkg/mod/github.com/x/y@v1.2.3/sub/z.go",
+			modulePath:    "github.com/x/y",
+			moduleVersion: "v1.2.3",
+			relFile:       "sub/z.go",
+			location:      "github.com/x/y@v1.2.3 sub/z.go:10",
+		},
+		{
+			function:      "github.com/BurntSushi/toml.Decode",
+			file:          "/home/me/go/pkg/mod/github.com/!burnt!sushi/toml@v0.3.1/decode.go",
+			modulePath:    "github.com/BurntSushi/toml",
+			moduleVersion: "v0.3.1",
+			relFile:       "decode.go",
+			location:      "github.com/BurntSushi/toml@v0.3.1 decode.go:10",
+		},
+		{
+			function: "github.com/me/app/server.(*Server).Run",
+			file:     "/build/src/github.com/me/app/server/server.go",
+			relFile:  "github.com/me/app/server/server.go",
+			location: "github.com/me/app/server/server.go:10",
+		},
+		{
+			function: "sync.runtime_Semacquire",
+			file:     "/usr/local/go/src/runtime/sema.go",
+			relFile:  "runtime/sema.go",
+			location: "runtime/sema.go:10",
+		},
+		{
+			function: "main.main",
+			file:     "/build/main.go",
+			location: "/build/main.go:10",
+		},
+	}
+
+	for _, c := range cases {
+		f := &Frame{Function: c.function, File: c.file, Line: 10}
+		f.setModuleInfo()
+		if f.ModulePath != c.modulePath || f.ModuleVersion != c.moduleVersion || f.RelFile != c.relFile {
+			t.Errorf("%s: expected (%q, %q, %q), got (%q, %q, %q)", c.file,
+				c.modulePath, c.moduleVersion, c.relFile,
+				f.ModulePath, f.ModuleVersion, f.RelFile)
+		}
+		if loc := f.Location(); loc != c.location {
+			t.Errorf("%s: expected location %q, got %q", c.file, c.location, loc)
+		}
+	}
+}
+
+func TestPathRewrites(t *testing.T) {
+	rw, err := ParsePathRewrite("/build/src=/home/me/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePathRewrite("/build/src"); err == nil {
+		t.Fatal("expected an error for a rule with no replacement")
+	}
+
+	input := `goroutine 1 [running]:
+main.main()
+	/build/src/app/main.go:10 +0x1d
+created by main.start
+	/build/src/app/start.go:3 +0x2
+`
+	stacks, err := ParseStacksWithOptions(strings.NewReader(input), ParseOptions{
+		PathRewrites: []PathRewrite{rw},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := stacks[0].Frames[0].File; f != "/home/me/src/app/main.go" {
+		t.Fatalf("expected frame file to be rewritten, got %q", f)
+	}
+	if f := stacks[0].CreatedBy.File; f != "/home/me/src/app/start.go" {
+		t.Fatalf("expected created by file to be rewritten, got %q", f)
+	}
+}
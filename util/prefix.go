@@ -0,0 +1,99 @@
+package stacks
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// PrefixFormat is a kind of log line prefix that can be trimmed off the
+// lines of a dump with a regular expression.
+type PrefixFormat struct {
+	Name    string
+	Pattern string
+}
+
+// KnownPrefixes are the log prefixes DetectLinePrefix looks for, most
+// specific first.
+var KnownPrefixes = []PrefixFormat{
+	// kubectl logs and the CRI log files under /var/log/pods
+	{"kubernetes", `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:\d\d) (?:stdout|stderr) [FP](?: |$)`},
+	// journalctl -o short-iso
+	{"journald-iso", `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:?\d\d) \S+ [^:\s]+(?:\[\d+\])?:(?: |$)`},
+	// journalctl's default output and syslog
+	{"journald", `^[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d \S+ [^:\s]+(?:\[\d+\])?:(?: |$)`},
+	// glog and klog
+	{"glog", `^[IWEF]\d{4} \d\d:\d\d:\d\d\.\d+\s+\d+ [^:\]]+:\d+\](?: |$)`},
+	// docker logs --timestamps
+	{"docker", `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d+Z(?: |$)`},
+	{"rfc3339", `^\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:?\d\d)?(?: |$)`},
+	// the standard library's log package
+	{"log", `^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d(?:\.\d+)?(?: |$)`},
+}
+
+var knownPrefixRegexps []*regexp.Regexp
+
+func init() {
+	for _, p := range KnownPrefixes {
+		knownPrefixRegexps = append(knownPrefixRegexps, regexp.MustCompile(p.Pattern))
+	}
+}
+
+// PrefixSampleSize is how much of the input DetectLinePrefix looks at. The
+// reader passed to it needs a buffer at least this big, see
+// bufio.NewReaderSize.
+const PrefixSampleSize = 64 << 10
+
+// DetectLinePrefix samples the start of the input for one of the
+// KnownPrefixes, without consuming anything from br. A prefix is only
+// picked if it is on most lines and trimming it leaves a goroutine header
+// somewhere, and never if the dump is already unprefixed.
+func DetectLinePrefix(br *bufio.Reader) (PrefixFormat, bool) {
+	sample, _ := br.Peek(PrefixSampleSize)
+	lines := strings.Split(string(sample), "\n")
+	if len(sample) == PrefixSampleSize && len(lines) > 1 {
+		// the last line is probably cut short
+		lines = lines[:len(lines)-1]
+	}
+	return detectLinePrefix(lines)
+}
+
+func detectLinePrefix(lines []string) (PrefixFormat, bool) {
+	var nonEmpty int
+	for _, l := range lines {
+		l = strings.TrimSuffix(l, "\r")
+		if l == "" {
+			continue
+		}
+		if strings.HasPrefix(l, "goroutine ") {
+			return PrefixFormat{}, false
+		}
+		nonEmpty++
+	}
+
+	best, bestCount := -1, 0
+	for i, re := range knownPrefixRegexps {
+		count, header := 0, false
+		for _, l := range lines {
+			l = strings.TrimSuffix(l, "\r")
+			loc := re.FindStringIndex(l)
+			if loc == nil {
+				continue
+			}
+			count++
+			if strings.HasPrefix(strings.TrimSpace(l[loc[1]:]), "goroutine ") {
+				header = true
+			}
+		}
+		// most lines should match, though logs often have other lines
+		// mixed in
+		if header && count > bestCount && 2*count > nonEmpty {
+			best, bestCount = i, count
+		}
+	}
+
+	if best < 0 {
+		return PrefixFormat{}, false
+	}
+	return KnownPrefixes[best], true
+}
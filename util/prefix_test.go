@@ -0,0 +1,82 @@
+package stacks
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestDetectLinePrefix(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{"kubernetes", "2021-03-04T10:00:00.123456789Z stderr F goroutine 1 [running]:\n2021-03-04T10:00:00.123456789Z stderr F main.main()\n2021-03-04T10:00:00.123456789Z stderr F \t/x/main.go:10 +0x1\n"},
+		{"journald-iso", "2021-03-04T10:00:00+0000 host app[12]: goroutine 1 [running]:\n2021-03-04T10:00:00+0000 host app[12]: main.main()\n"},
+		{"journald", "Mar  4 10:00:00 host app[12]: goroutine 1 [running]:\nMar  4 10:00:00 host app[12]: main.main()\nMar  4 10:00:00 host app[12]:         /x/main.go:10 +0x1\n"},
+		{"glog", "E0304 10:00:00.123456   12 main.go:5] goroutine 1 [running]:\nE0304 10:00:00.123456   12 main.go:5] main.main()\n"},
+		{"docker", "2021-03-04T10:00:00.123456789Z goroutine 1 [running]:\n2021-03-04T10:00:00.123456789Z main.main()\n2021-03-04T10:00:00.123456789Z \n"},
+		{"rfc3339", "2021-03-04 10:00:00 goroutine 1 [running]:\n2021-03-04 10:00:00 main.main()\n"},
+		{"log", "2021/03/04 10:00:00 goroutine 1 [running]:\n2021/03/04 10:00:00 main.main()\n"},
+	}
+
+	for _, c := range cases {
+		pf, ok := DetectLinePrefix(bufio.NewReader(strings.NewReader(c.input)))
+		if !ok || pf.Name != c.name {
+			t.Errorf("%s: detected %q (%v)", c.name, pf.Name, ok)
+		}
+	}
+
+	for _, input := range []string{
+		tracebackInput,
+		"2021/03/04 10:00:00 starting up\n2021/03/04 10:00:00 listening\n",
+	} {
+		if pf, ok := DetectLinePrefix(bufio.NewReader(strings.NewReader(input))); ok {
+			t.Errorf("expected no prefix to be detected, got %q for:\n%s", pf.Name, input)
+		}
+	}
+}
+
+func TestParseDetectedPrefix(t *testing.T) {
+	input := "Mar  4 10:00:00 host app[12]: goroutine 1 [running]:\n" +
+		"Mar  4 10:00:00 host app[12]: main.main()\n" +
+		"Mar  4 10:00:00 host app[12]:         /x/main.go:10 +0x1\n" +
+		"Mar  4 10:00:00 host app[12]: \n" +
+		"Mar  4 10:00:00 host app[12]: goroutine 2 [select]:\n" +
+		"Mar  4 10:00:00 host app[12]: main.worker()\n" +
+		"Mar  4 10:00:00 host app[12]:         /x/main.go:20 +0x1\n"
+
+	stacks, err := ParseStacksWithOptions(strings.NewReader(input), ParseOptions{DetectPrefix: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 2 || stacks[1].Frames[0].File != "/x/main.go" {
+		t.Fatalf("unexpected stacks: %v", stacks)
+	}
+}
+
+func TestDetectPrefixAfterNoise(t *testing.T) {
+	const prefix = "2021-03-04T10:00:00.123456789Z stderr F "
+	var sb strings.Builder
+	for sb.Len() < 6<<10 {
+		sb.WriteString(prefix + "level=info msg=\"handled request\" path=/healthz\n")
+	}
+	sb.WriteString(prefix + "goroutine 1 [running]:\n" + prefix + "main.main()\n" + prefix + "\t/x/main.go:10 +0x1\n" + prefix + "\n")
+	for sb.Len() < 2*PrefixSampleSize {
+		sb.WriteString(prefix + "level=info msg=\"shutting down\"\n")
+	}
+	input := sb.String()
+
+	pf, ok := DetectLinePrefix(bufio.NewReaderSize(strings.NewReader(input), PrefixSampleSize))
+	if !ok || pf.Name != "kubernetes" {
+		t.Fatalf("detected %q (%v)", pf.Name, ok)
+	}
+
+	stacks, _, err := ParseStacksWithDiagnostics(strings.NewReader(input), ParseOptions{DetectPrefix: true, Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 || stacks[0].Frames[0].File != "/x/main.go" {
+		t.Fatalf("unexpected stacks: %v", stacks)
+	}
+}
@@ -0,0 +1,62 @@
+package stacks
+
+// HideRuntime returns a copy of s without frames in the runtime package,
+// such as runtime.gopark. Stacks made up entirely of runtime frames are left
+// alone rather than emptied.
+func (s *Stack) HideRuntime() *Stack {
+	var frames []Frame
+	elidedAt := -1
+	for i := range s.Frames {
+		if i == s.ElidedAt {
+			elidedAt = len(frames)
+		}
+		if !s.Frames[i].IsRuntime() {
+			frames = append(frames, s.Frames[i])
+		}
+	}
+	if len(frames) == 0 {
+		return s
+	}
+
+	out := *s
+	out.Frames = frames
+	if elidedAt >= 0 {
+		out.ElidedAt = elidedAt
+	}
+	return &out
+}
+
+// CollapseStdlib returns a copy of s with each run of two or more
+// consecutive standard library frames folded into a single frame, see
+// Frame.Collapsed. Runs aren't folded across elided frames.
+func (s *Stack) CollapseStdlib() *Stack {
+	var frames []Frame
+	elidedAt := -1
+	for i := 0; i < len(s.Frames); {
+		if i == s.ElidedAt {
+			elidedAt = len(frames)
+		}
+		j := i
+		for j < len(s.Frames) && s.Frames[j].IsStdlib() && (j == i || j != s.ElidedAt || s.ElidedCount == 0) {
+			j++
+		}
+
+		switch {
+		case j-i >= 2:
+			f := s.Frames[j-1]
+			f.Collapsed = j - i
+			frames = append(frames, f)
+			i = j
+		default:
+			frames = append(frames, s.Frames[i])
+			i++
+		}
+	}
+
+	out := *s
+	out.Frames = frames
+	if elidedAt >= 0 {
+		out.ElidedAt = elidedAt
+	}
+	return &out
+}
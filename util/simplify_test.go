@@ -0,0 +1,115 @@
+package stacks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const simplifyInput = `goroutine 7 [select]:
+runtime.gopark(0x1, 0x2, 0x3, 0x4, 0x5)
+	/usr/local/go/src/runtime/proc.go:337 +0xd6
+runtime.selectgo(0xc000123f00, 0xc000123e90, 0x2, 0x1, 0x1)
+	/usr/local/go/src/runtime/select.go:319 +0xa54
+net/http.(*persistConn).readLoop(0xc000184000)
+	/usr/local/go/src/net/http/transport.go:2203 +0xd8a
+net/http.(*Transport).dialConn(0xc000100000)
+	/usr/local/go/src/net/http/transport.go:1747 +0x1a3
+github.com/me/app.(*Client).Do(0xc000010000)
+	/build/src/github.com/me/app/client.go:42 +0x55
+sync.(*Once).Do(0xc000010010)
+	/usr/local/go/src/sync/once.go:59 +0x3b
+main.main()
+	/build/src/github.com/me/app/main.go:10 +0x20
+created by main.start
+	/build/src/github.com/me/app/main.go:3 +0x2
+`
+
+func functionNames(s *Stack) []string {
+	var out []string
+	for _, f := range s.Frames {
+		out = append(out, f.Function)
+	}
+	return out
+}
+
+func TestHideRuntime(t *testing.T) {
+	stacks, err := ParseStacks(strings.NewReader(simplifyInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"net/http.(*persistConn).readLoop",
+		"net/http.(*Transport).dialConn",
+		"github.com/me/app.(*Client).Do",
+		"sync.(*Once).Do",
+		"main.main",
+	}
+	if got := functionNames(stacks[0].HideRuntime()); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if len(stacks[0].Frames) != 7 {
+		t.Fatal("HideRuntime modified the original stack")
+	}
+
+	onlyRuntime := &Stack{Frames: []Frame{{Function: "runtime.goexit"}}}
+	if got := onlyRuntime.HideRuntime(); len(got.Frames) != 1 {
+		t.Fatal("expected a stack of only runtime frames to be left alone")
+	}
+}
+
+func TestCollapseStdlib(t *testing.T) {
+	stacks, err := ParseStacks(strings.NewReader(simplifyInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := stacks[0].CollapseStdlib()
+	expected := []string{
+		"net/http.(*Transport).dialConn",
+		"github.com/me/app.(*Client).Do",
+		"sync.(*Once).Do",
+		"main.main",
+	}
+	if names := functionNames(got); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	if got.Frames[0].Collapsed != 4 || got.Frames[2].Collapsed != 0 {
+		t.Fatalf("unexpected collapse counts: %d, %d", got.Frames[0].Collapsed, got.Frames[2].Collapsed)
+	}
+	if s := got.Frames[0].String(); s != "... 4 stdlib frames (net/http.(*Transport).dialConn) ..." {
+		t.Fatalf("unexpected collapsed frame string: %q", s)
+	}
+}
+
+func TestSimplifyElidedFrames(t *testing.T) {
+	stacks, err := ParseStacks(strings.NewReader(simplifyInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// frames left out between readLoop and dialConn
+	s := stacks[0]
+	s.ElidedAt, s.ElidedCount = 3, 10
+
+	if got := s.HideRuntime(); got.ElidedAt != 1 || got.ElidedCount != 10 {
+		t.Errorf("expected the elided frames before frame 1 without runtime frames, got %d", got.ElidedAt)
+	}
+
+	// the run of stdlib frames is split at the elided frames
+	got := s.CollapseStdlib()
+	expected := []string{
+		"net/http.(*persistConn).readLoop",
+		"net/http.(*Transport).dialConn",
+		"github.com/me/app.(*Client).Do",
+		"sync.(*Once).Do",
+		"main.main",
+	}
+	if names := functionNames(got); !reflect.DeepEqual(names, expected) || got.ElidedAt != 1 {
+		t.Fatalf("expected %v elided before frame 1, got %v elided before %d", expected, names, got.ElidedAt)
+	}
+	if got.Frames[0].Collapsed != 3 {
+		t.Errorf("expected the 3 frames before the elided ones to be collapsed, got %d", got.Frames[0].Collapsed)
+	}
+}
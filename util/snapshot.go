@@ -0,0 +1,86 @@
+package stacks
+
+import (
+	"regexp"
+	"time"
+)
+
+// Snapshot is one goroutine dump out of an input that may hold several,
+// such as a log file of a process that was sent SIGQUIT more than once.
+type Snapshot struct {
+	// Line is the line of the input the dump starts on.
+	Line int
+
+	// Time is when the dump was taken, if the input has timestamps in its
+	// line prefixes, and zero otherwise.
+	Time time.Time
+
+	Stacks []*Stack
+}
+
+// dumpGap is how long a pause between consecutive timestamped lines must
+// be for them to be considered separate dumps. The runtime writes a whole
+// dump in one go, so even a big one shouldn't pause this long.
+const dumpGap = 5 * time.Second
+
+// signalLine matches the line the runtime starts a dump with when killed
+// by a signal, e.g. "SIGQUIT: quit".
+var signalLine = regexp.MustCompile(`^SIG[A-Z0-9]+: `)
+
+// isDumpBoundary reports whether line starts a new dump.
+func isDumpBoundary(line string) bool {
+	return signalLine.MatchString(line)
+}
+
+// crashDetail matches the lines the runtime prints around the goroutines
+// when killed by a signal: the "PC=0x46ee41 m=0 sigcode=0" line after the
+// signal and the register dump at the end.
+var crashDetail = regexp.MustCompile(`^(PC=0x[0-9a-f]+ m=|[a-z0-9]{2,6}\s+0x[0-9a-f]+$)`)
+
+// isCrashDetail reports whether line is part of the runtime's output on a
+// fatal signal that isn't a goroutine.
+func isCrashDetail(line string) bool {
+	return crashDetail.MatchString(line)
+}
+
+// timestampFormats are the timestamps recognized in line prefixes, with a
+// pattern to find them and the layout to parse them with. If the pattern
+// has a group, only that part of the match is parsed.
+var timestampFormats = []struct {
+	re     *regexp.Regexp
+	layout string
+}{
+	{regexp.MustCompile(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:\d\d)`), time.RFC3339Nano},
+	{regexp.MustCompile(`\d{4}-\d\d-\d\d \d\d:\d\d:\d\d(?:\.\d+)?`), "2006-01-02 15:04:05.999999999"},
+	{regexp.MustCompile(`\d{4}/\d\d/\d\d \d\d:\d\d:\d\d(?:\.\d+)?`), "2006/01/02 15:04:05.999999999"},
+	{regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d`), time.Stamp},
+	// glog and klog, e.g. "I0102 15:04:05.123456"
+	{regexp.MustCompile(`\b[IWEF](\d{4} \d\d:\d\d:\d\d\.\d+)`), "0102 15:04:05.999999999"},
+}
+
+// findTimestamp looks for a timestamp in s, typically a log line prefix.
+func findTimestamp(s string) (time.Time, bool) {
+	for _, f := range timestampFormats {
+		m := f.re.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		ts := m[0]
+		if len(m) > 1 {
+			ts = m[1]
+		}
+		if t, err := time.Parse(f.layout, ts); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// flattenSnapshots returns the stacks of all of snaps in order.
+func flattenSnapshots(snaps []*Snapshot) []*Stack {
+	var stacks []*Stack
+	for _, s := range snaps {
+		stacks = append(stacks, s.Stacks...)
+	}
+	return stacks
+}
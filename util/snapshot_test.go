@@ -0,0 +1,152 @@
+package stacks
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sigquitInput = `SIGQUIT: quit
+PC=0x46ee41 m=0 sigcode=0
+
+goroutine 1 [running]:
+main.main()
+	/x/main.go:10 +0x1
+
+goroutine 5 [select]:
+main.worker()
+	/x/main.go:20 +0x1
+
+rax    0xca
+rip    0x46ee41
+SIGQUIT: quit
+PC=0x46ee41 m=0 sigcode=0
+
+goroutine 1 [running]:
+main.main()
+	/x/main.go:10 +0x1
+
+goroutine 1 [running]:
+main.main()
+	/x/main.go:10 +0x1
+`
+
+func snapshotNumbers(snaps []*Snapshot) [][]int {
+	var out [][]int
+	for _, s := range snaps {
+		var nums []int
+		for _, st := range s.Stacks {
+			nums = append(nums, st.Number)
+		}
+		out = append(out, nums)
+	}
+	return out
+}
+
+func TestParseSnapshots(t *testing.T) {
+	snaps, _, err := ParseSnapshots(strings.NewReader(sigquitInput), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second dump is split again on goroutine 1 repeating
+	expected := [][]int{{1, 5}, {1}, {1}}
+	if got := snapshotNumbers(snaps); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected snapshots %v, got %v", expected, got)
+	}
+	if snaps[0].Line != 1 || snaps[1].Line != 14 || snaps[2].Line != 21 {
+		t.Errorf("unexpected snapshot lines %d, %d, %d", snaps[0].Line, snaps[1].Line, snaps[2].Line)
+	}
+
+	all, err := ParseStacks(strings.NewReader(sigquitInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Errorf("expected ParseStacks to return all 4 stacks, got %d", len(all))
+	}
+}
+
+func TestParseSnapshotsServiceLog(t *testing.T) {
+	input := `starting server on localhost:8080
+SIGQUIT: quit
+PC=0x46ee41 m=0 sigcode=0
+
+goroutine 1 [running]:
+main.main()
+	/x/main.go:10 +0x1
+
+exit status 2
+restarting (attempt 2)
+starting server on localhost:8080
+SIGQUIT: quit
+
+goroutine 1 [running]:
+main.main()
+	/x/main.go:10 +0x1
+`
+	snaps, diags, err := ParseSnapshots(strings.NewReader(input), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diags)
+	}
+	if got := snapshotNumbers(snaps); !reflect.DeepEqual(got, [][]int{{1}, {1}}) {
+		t.Fatalf("expected two snapshots, got %v", got)
+	}
+
+	// goroutine lines outside a goroutine are still an error
+	orphan := "goroutine 1 [running]:\nmain.main()\n\t/x/main.go:10 +0x1\n\n\t/x/main.go:3 +0x2\n"
+	_, _, err = ParseSnapshots(strings.NewReader(orphan), ParseOptions{})
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Kind != ErrOrphanLine || perr.Line != 5 {
+		t.Fatalf("expected an orphan line error on line 5, got %v", err)
+	}
+}
+
+func TestParseSnapshotsTimestampGap(t *testing.T) {
+	input := `2021-03-04T10:00:00.000Z goroutine 1 [running]:
+2021-03-04T10:00:00.001Z main.main()
+2021-03-04T10:00:00.001Z 	/x/main.go:10 +0x1
+2021-03-04T10:00:00.002Z
+2021-03-04T10:00:30.000Z goroutine 2 [running]:
+2021-03-04T10:00:30.001Z main.main()
+2021-03-04T10:00:30.001Z 	/x/main.go:10 +0x1
+`
+	snaps, _, err := ParseSnapshots(strings.NewReader(input), ParseOptions{LinePrefix: `^\S+ ?`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshotNumbers(snaps); !reflect.DeepEqual(got, [][]int{{1}, {2}}) {
+		t.Fatalf("expected two snapshots, got %v", got)
+	}
+	if want := time.Date(2021, 3, 4, 10, 0, 30, 0, time.UTC); !snaps[1].Time.Equal(want) {
+		t.Errorf("expected the second snapshot at %s, got %s", want, snaps[1].Time)
+	}
+}
+
+func TestFindTimestamp(t *testing.T) {
+	cases := []struct {
+		prefix string
+		want   time.Time
+	}{
+		{"2021-03-04T10:00:00.5Z app[1]: ", time.Date(2021, 3, 4, 10, 0, 0, 500000000, time.UTC)},
+		{"2021-03-04 10:00:00 ", time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)},
+		{"2021/03/04 10:00:00.25 ", time.Date(2021, 3, 4, 10, 0, 0, 250000000, time.UTC)},
+		{"Mar  4 10:00:00 host app[1]: ", time.Date(0, 3, 4, 10, 0, 0, 0, time.UTC)},
+		{"I0304 10:00:00.123456   12 main.go:5] ", time.Date(0, 3, 4, 10, 0, 0, 123456000, time.UTC)},
+	}
+	for _, c := range cases {
+		got, ok := findTimestamp(c.prefix)
+		if !ok || !got.Equal(c.want) {
+			t.Errorf("%q: expected %s, got %s (%v)", c.prefix, c.want, got, ok)
+		}
+	}
+
+	if _, ok := findTimestamp("app[1]: "); ok {
+		t.Error("expected no timestamp in a prefix without one")
+	}
+}
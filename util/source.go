@@ -0,0 +1,166 @@
+package stacks
+
+import (
+	"bufio"
+	"go/build"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// SourceLine is a single line of a source file.
+type SourceLine struct {
+	Number int64
+	Text   string
+}
+
+// SourceResolver finds local copies of the files referenced by frames. Dumps
+// usually come from another machine, so paths are tried against the module
+// cache, GOROOT and the configured roots before giving up.
+type SourceResolver struct {
+	// Roots are searched for files outside the module cache and GOROOT,
+	// with leading path components of the frame's file stripped one at a
+	// time until a match is found. At least the file's directory must
+	// match, so that a bare main.go isn't mistaken for another, unless the
+	// file looks to be at the top of the root: none of its directories
+	// are there.
+	Roots []string
+
+	GoRoot   string
+	ModCache string
+
+	files map[string][]string
+}
+
+// NewSourceResolver returns a resolver using the given roots along with the
+// GOROOT and module cache of the local Go installation.
+func NewSourceResolver(roots []string) *SourceResolver {
+	goroot := os.Getenv("GOROOT")
+	if goroot == "" {
+		goroot = runtime.GOROOT()
+	}
+
+	modcache := os.Getenv("GOMODCACHE")
+	if modcache == "" {
+		if gopath := filepath.SplitList(build.Default.GOPATH); len(gopath) > 0 {
+			modcache = filepath.Join(gopath[0], "pkg", "mod")
+		}
+	}
+
+	return &SourceResolver{
+		Roots:    roots,
+		GoRoot:   goroot,
+		ModCache: modcache,
+	}
+}
+
+// Resolve returns the local path for a file named in a stack trace.
+func (r *SourceResolver) Resolve(file string) (string, bool) {
+	slashed := filepath.ToSlash(file)
+
+	if r.ModCache != "" {
+		if n := strings.LastIndex(slashed, "pkg/mod/"); n >= 0 {
+			if p := filepath.Join(r.ModCache, slashed[n+len("pkg/mod/"):]); fileExists(p) {
+				return p, true
+			}
+		}
+	}
+
+	if r.GoRoot != "" {
+		if n := strings.LastIndex(slashed, "/src/"); n >= 0 {
+			if p := filepath.Join(r.GoRoot, "src", slashed[n+len("/src/"):]); fileExists(p) {
+				return p, true
+			}
+		}
+	}
+
+	parts := strings.Split(strings.TrimPrefix(slashed, "/"), "/")
+	for _, root := range r.Roots {
+		for i := 0; i < len(parts)-1; i++ {
+			if p := filepath.Join(root, filepath.Join(parts[i:]...)); fileExists(p) {
+				return p, true
+			}
+		}
+	}
+	for _, root := range r.Roots {
+		if !inRoot(root, parts[:len(parts)-1]) {
+			if p := filepath.Join(root, parts[len(parts)-1]); fileExists(p) {
+				return p, true
+			}
+		}
+	}
+
+	if filepath.IsAbs(file) && fileExists(file) {
+		return file, true
+	}
+
+	return "", false
+}
+
+// Context returns up to n lines either side of the given line of file. It
+// returns nil if the file can't be found locally or is too short.
+func (r *SourceResolver) Context(file string, line int64, n int) []SourceLine {
+	lines := r.load(file)
+	if line < 1 || line > int64(len(lines)) {
+		return nil
+	}
+
+	start := line - int64(n)
+	if start < 1 {
+		start = 1
+	}
+	end := line + int64(n)
+	if end > int64(len(lines)) {
+		end = int64(len(lines))
+	}
+
+	var out []SourceLine
+	for i := start; i <= end; i++ {
+		out = append(out, SourceLine{
+			Number: i,
+			Text:   lines[i-1],
+		})
+	}
+	return out
+}
+
+func (r *SourceResolver) load(file string) []string {
+	if r.files == nil {
+		r.files = make(map[string][]string)
+	}
+	if lines, ok := r.files[file]; ok {
+		return lines
+	}
+
+	var lines []string
+	if p, ok := r.Resolve(file); ok {
+		if fi, err := os.Open(p); err == nil {
+			scan := bufio.NewScanner(fi)
+			scan.Buffer(nil, 1024*1024)
+			for scan.Scan() {
+				lines = append(lines, scan.Text())
+			}
+			fi.Close()
+		}
+	}
+
+	// cache misses too, so missing files are only looked for once
+	r.files[file] = lines
+	return lines
+}
+
+// inRoot reports whether any of dirs is a directory at the top of root.
+func inRoot(root string, dirs []string) bool {
+	for _, d := range dirs {
+		if st, err := os.Stat(filepath.Join(root, d)); err == nil && st.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func fileExists(p string) bool {
+	st, err := os.Stat(p)
+	return err == nil && !st.IsDir()
+}
@@ -0,0 +1,104 @@
+package stacks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeSourceFile(t *testing.T, path string, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSourceResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackparse-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goroot := filepath.Join(dir, "goroot")
+	modcache := filepath.Join(dir, "modcache")
+	root := filepath.Join(dir, "checkout")
+
+	writeSourceFile(t, filepath.Join(goroot, "src", "sync", "waitgroup.go"), "package sync\n")
+	writeSourceFile(t, filepath.Join(modcache, "github.com", "x", "y@v1.2.3", "z.go"), "package y\n")
+	writeSourceFile(t, filepath.Join(root, "cmd", "server", "main.go"), "package main\n")
+	writeSourceFile(t, filepath.Join(root, "main.go"), "package main\n")
+	writeSourceFile(t, filepath.Join(root, "mutex.go"), "package other\n")
+	writeSourceFile(t, filepath.Join(root, "sync", "waitgroup.go"), "package sync\n")
+
+	r := &SourceResolver{
+		Roots:    []string{root},
+		GoRoot:   goroot,
+		ModCache: modcache,
+	}
+
+	cases := []struct {
+		file     string
+		expected string
+	}{
+		{"/opt/ci/go/src/sync/waitgroup.go", filepath.Join(goroot, "src", "sync", "waitgroup.go")},
+		{"/go/pkg/mod/github.com/x/y@v1.2.3/z.go", filepath.Join(modcache, "github.com", "x", "y@v1.2.3", "z.go")},
+		{"pkg/mod/github.com/x/y@v1.2.3/z.go", filepath.Join(modcache, "github.com", "x", "y@v1.2.3", "z.go")},
+		{"/build/src/cmd/server/main.go", filepath.Join(root, "cmd", "server", "main.go")},
+		{"/build/src/cmd/server/missing.go", ""},
+		// a file name alone isn't enough to match in a directory the root
+		// has, but is for a file at the top of the root
+		{"/build/src/cmd/client/main.go", ""},
+		{"/opt/ci/go/src/sync/mutex.go", ""},
+		{"/build/src/main.go", filepath.Join(root, "main.go")},
+	}
+
+	for _, c := range cases {
+		got, ok := r.Resolve(c.file)
+		if ok != (c.expected != "") || got != c.expected {
+			t.Errorf("%s: expected %q, got %q (found: %v)", c.file, c.expected, got, ok)
+		}
+	}
+}
+
+func TestSourceContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackparse-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "a.go")
+	writeSourceFile(t, file, "one\ntwo\nthree\nfour\nfive\n")
+
+	r := &SourceResolver{}
+
+	expected := []SourceLine{
+		{Number: 1, Text: "one"},
+		{Number: 2, Text: "two"},
+		{Number: 3, Text: "three"},
+	}
+	if got := r.Context(file, 2, 1); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	expected = []SourceLine{
+		{Number: 3, Text: "three"},
+		{Number: 4, Text: "four"},
+		{Number: 5, Text: "five"},
+	}
+	if got := r.Context(file, 5, 2); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	if got := r.Context(file, 6, 2); got != nil {
+		t.Fatalf("expected no lines past the end of the file, got %v", got)
+	}
+	if got := r.Context(filepath.Join(dir, "missing.go"), 1, 2); got != nil {
+		t.Fatalf("expected no lines for a missing file, got %v", got)
+	}
+}
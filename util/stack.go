@@ -2,8 +2,10 @@ package stacks
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"regexp"
 	"runtime/debug"
 	"strconv"
@@ -19,34 +21,151 @@ type Stack struct {
 	ThreadLocked bool
 	CreatedBy    CreatedBy
 	FramesElided bool
+
+	// ElidedCount frames were left out just before Frames[ElidedAt], which
+	// Go 1.21 and later mark with "...N frames elided..." in the middle of
+	// deep stacks.
+	ElidedAt    int `json:",omitempty"`
+	ElidedCount int `json:",omitempty"`
+
+	// BaseState and StateQualifier are State split into the state itself
+	// and the parenthesized detail after it, e.g. "chan receive" and "nil
+	// chan" for "chan receive (nil chan)".
+	BaseState      string `json:",omitempty"`
+	StateQualifier string `json:",omitempty"`
+
+	// GP, M and MP are the goroutine's g, the id of the M running it and
+	// that M's address, when the dump includes them.
+	GP string `json:",omitempty"`
+	M  string `json:",omitempty"`
+	MP string `json:",omitempty"`
+
+	// Fields and Attrs hold the parts of the goroutine header that aren't
+	// otherwise understood, verbatim: Fields those before the brackets and
+	// Attrs those inside them, so Header can put them back where they were.
+	Fields []string `json:",omitempty"`
+	Attrs  []string `json:",omitempty"`
 }
 
-func (s *Stack) String() string {
+// Header returns the "goroutine N [state]:" line that starts the stack.
+func (s *Stack) Header() string {
 	sb := strings.Builder{}
-	state := s.State
+	sb.WriteString(fmt.Sprintf("goroutine %d", s.Number))
+	if s.GP != "" {
+		sb.WriteString(" gp=" + s.GP)
+	}
+	if s.M != "" {
+		sb.WriteString(" m=" + s.M)
+	}
+	if s.MP != "" {
+		sb.WriteString(" mp=" + s.MP)
+	}
+	for _, f := range s.Fields {
+		sb.WriteString(" " + f)
+	}
+
+	sb.WriteString(" [" + s.State)
 	waitTime := int(s.WaitTime.Minutes())
 	if waitTime != 0 {
-		state += ", " + fmt.Sprintf("%d minutes", waitTime)
+		sb.WriteString(fmt.Sprintf(", %d minutes", waitTime))
 	}
-	sb.WriteString(fmt.Sprintf("goroutine %d [%s]:\n", s.Number, state))
-	for _, f := range s.Frames {
-		sb.WriteString(f.String())
-		sb.WriteRune('\n')
+	if s.ThreadLocked {
+		sb.WriteString(", locked to thread")
 	}
-	sb.WriteString(s.CreatedBy.String())
+	for _, a := range s.Attrs {
+		sb.WriteString(", " + a)
+	}
+	sb.WriteString("]:")
+	return sb.String()
+}
+
+func (s *Stack) String() string {
+	return s.format(true)
+}
+
+// Traceback returns the stack exactly as the Go runtime prints it, so that
+// it can be read back in by ParseStacks or other tools. Unlike String,
+// frames folded by CollapseStdlib are written as ordinary frames.
+func (s *Stack) Traceback() string {
+	return s.format(false)
+}
+
+func (s *Stack) format(showCollapsed bool) string {
+	sb := strings.Builder{}
+	sb.WriteString(s.Header())
 	sb.WriteRune('\n')
+	for i := range s.Frames {
+		f := &s.Frames[i]
+		if m := s.ElidedMarker(i); m != "" {
+			sb.WriteString(m + "\n")
+		}
+		if showCollapsed {
+			sb.WriteString(f.String())
+		} else {
+			sb.WriteString(f.traceback())
+		}
+		sb.WriteRune('\n')
+	}
+	if s.FramesElided {
+		sb.WriteString("...additional frames elided...\n")
+	}
+	if s.CreatedBy.Function != "" {
+		sb.WriteString(s.CreatedBy.String())
+		sb.WriteRune('\n')
+	}
 	return sb.String()
 }
 
+// ElidedMarker returns the "...N frames elided..." line to print before
+// the ith frame, if frames were left out there.
+func (s *Stack) ElidedMarker(i int) string {
+	if s.ElidedCount == 0 || i != s.ElidedAt {
+		return ""
+	}
+	return fmt.Sprintf("...%d frames elided...", s.ElidedCount)
+}
+
+// WriteTracebacks writes stacks in the same format as a goroutine dump from
+// the Go runtime, with a blank line after each.
+func WriteTracebacks(w io.Writer, stacks []*Stack) error {
+	for _, s := range stacks {
+		if _, err := io.WriteString(w, s.Traceback()+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type Frame struct {
 	Function string
 	Params   []string
 	File     string
 	Line     int64
 	Entry    int64
+
+	// These are derived from File when the stack is parsed. ModulePath
+	// and ModuleVersion are set for files in the module cache, and RelFile
+	// is the file relative to its module root or GOPATH/GOROOT src
+	// directory, if that can be worked out. They let frames be compared
+	// across machines with different build roots.
+	ModulePath    string `json:",omitempty"`
+	ModuleVersion string `json:",omitempty"`
+	RelFile       string `json:",omitempty"`
+
+	// Collapsed is set on frames standing in for a run of standard library
+	// frames folded together by CollapseStdlib, and counts how many there
+	// were. The rest of the frame describes the outermost one.
+	Collapsed int `json:",omitempty"`
 }
 
 func (f *Frame) String() string {
+	if f.Collapsed > 0 {
+		return fmt.Sprintf("... %d stdlib frames (%s) ...", f.Collapsed, f.Function)
+	}
+	return f.traceback()
+}
+
+func (f *Frame) traceback() string {
 	sb := strings.Builder{}
 	sb.WriteString(fmt.Sprintf("%s(%s)\n", f.Function, strings.Join(f.Params, ", ")))
 	sb.WriteString(fmt.Sprintf("\t%s:%d", f.File, f.Line))
@@ -61,11 +180,19 @@ type CreatedBy struct {
 	File     string
 	Line     int64
 	Entry    int64
+
+	// Goroutine is the number of the creating goroutine, which Go 1.21 and
+	// later print as "created by F in goroutine N".
+	Goroutine int `json:",omitempty"`
 }
 
 func (c *CreatedBy) String() string {
 	sb := strings.Builder{}
-	sb.WriteString(fmt.Sprintf("created by %s\n", c.Function))
+	sb.WriteString("created by " + c.Function)
+	if c.Goroutine != 0 {
+		sb.WriteString(fmt.Sprintf(" in goroutine %d", c.Goroutine))
+	}
+	sb.WriteRune('\n')
 	sb.WriteString(fmt.Sprintf("\t%s:%d", c.File, c.Line))
 	if c.Entry != 0 {
 		sb.WriteString(fmt.Sprintf(" %+#x", c.Entry))
@@ -93,10 +220,16 @@ func (s *Stack) Sameish(os *Stack) bool {
 
 type Filter func(s *Stack) bool
 
+// Matches reports whether the frame's function or file:line contains
+// pattern.
+func (f *Frame) Matches(pattern string) bool {
+	return strings.Contains(f.Function, pattern) || strings.Contains(fmt.Sprintf("%s:%d", f.File, f.Line), pattern)
+}
+
 func HasFrameMatching(pattern string) Filter {
 	return func(s *Stack) bool {
-		for _, f := range s.Frames {
-			if strings.Contains(f.Function, pattern) || strings.Contains(fmt.Sprintf("%s:%d", f.File, f.Line), pattern) {
+		for i := range s.Frames {
+			if s.Frames[i].Matches(pattern) {
 				return true
 			}
 		}
@@ -137,37 +270,274 @@ next:
 	return out
 }
 
-func ParseStacks(r io.Reader, linePrefix string) (_ []*Stack, _err error) {
+// ParseOptions controls how ParseStacksWithOptions reads a dump.
+type ParseOptions struct {
+	// LinePrefix is a regular expression matching junk at the start of
+	// each line, such as a log timestamp, to be trimmed off.
+	LinePrefix string
+
+	// PathRewrites are applied to the file of every frame, in order, with
+	// the first matching rule winning.
+	PathRewrites []PathRewrite
+
+	// JSONField, if set, reads the dump out of the given field of JSON log
+	// lines, see NewJSONFieldReader.
+	JSONField string
+
+	// DetectPrefix looks for one of the KnownPrefixes at the start of the
+	// input if LinePrefix isn't set, see DetectLinePrefix.
+	DetectPrefix bool
+
+	// Lenient skips over goroutines and lines that can't be parsed, keeping
+	// as much of each goroutine as possible, instead of failing.
+	Lenient bool
+}
+
+func ParseStacks(r io.Reader, linePrefix string) ([]*Stack, error) {
+	return ParseStacksWithOptions(r, ParseOptions{LinePrefix: linePrefix})
+}
+
+// ParseStacksWithOptions parses a goroutine dump. In lenient mode problems
+// are skipped over rather than returned as an error; use
+// ParseStacksWithDiagnostics to find out what they were. Otherwise bad input
+// gives a *ParseError, along with the stacks parsed before it.
+func ParseStacksWithOptions(r io.Reader, opts ParseOptions) ([]*Stack, error) {
+	stacks, _, err := ParseStacksWithDiagnostics(r, opts)
+	return stacks, err
+}
+
+// Diagnostic describes a problem with the input found in lenient mode, and
+// skipped or worked around.
+type Diagnostic struct {
+	Kind ParseErrorKind
+
+	// Line is the 1-based line number the problem was found on, and Offset
+	// the byte offset of the start of that line.
+	Line   int
+	Offset int64
+
+	// Goroutine is the number of the goroutine being parsed, or -1 if the
+	// line wasn't part of one that could be identified.
+	Goroutine int
+	Problem   string
+	// Text is the offending line.
+	Text string
+}
+
+func (d Diagnostic) String() string {
+	if d.Goroutine < 0 {
+		return fmt.Sprintf("line %d: %s: %q", d.Line, d.Problem, d.Text)
+	}
+	return fmt.Sprintf("line %d (goroutine %d): %s: %q", d.Line, d.Goroutine, d.Problem, d.Text)
+}
+
+// maxLineLength bounds the lines we'll read, frames with huge argument
+// lists aside they're rarely more than a few hundred bytes.
+const maxLineLength = 16 << 20
+
+// ParseStacksWithDiagnostics is ParseStacksWithOptions, also returning the
+// problems found in the input when opts.Lenient is set.
+//
+// If the input can't be parsed the error is a *ParseError, and the stacks
+// completed before the problem are returned along with it.
+func ParseStacksWithDiagnostics(r io.Reader, opts ParseOptions) ([]*Stack, []Diagnostic, error) {
+	snaps, diags, err := ParseSnapshots(r, opts)
+	return flattenSnapshots(snaps), diags, err
+}
+
+// ParseSnapshots is ParseStacksWithDiagnostics for input that may hold
+// several dumps one after the other, returning the stacks of each
+// separately. A new dump starts at a line like "SIGQUIT: quit", when a
+// goroutine number repeats, or after a pause of more than a few seconds in
+// the timestamps of the line prefixes.
+func ParseSnapshots(r io.Reader, opts ParseOptions) (_snaps []*Snapshot, _ []Diagnostic, _err error) {
 	var re *regexp.Regexp
 
-	if linePrefix != "" {
-		r, err := regexp.Compile(linePrefix)
+	if opts.LinePrefix != "" {
+		r, err := regexp.Compile(opts.LinePrefix)
 		if err != nil {
-			return nil, fmt.Errorf("failed to compile line prefix regexp")
+			return nil, nil, fmt.Errorf("failed to compile line prefix regexp")
 		}
 		re = r
 	}
 
+	if opts.JSONField != "" {
+		r = NewJSONFieldReader(r, opts.JSONField)
+	}
+
+	// Our own JSON output can be read back in, so that runs of stackparse
+	// can be chained together. Text that merely starts like JSON, or JSON
+	// that isn't stacks, is parsed as a dump as usual.
+	br := bufio.NewReaderSize(r, PrefixSampleSize)
+	var jsonErr error
+	if c, err := peekNonSpace(br); err == nil && (c == '[' || c == '{') && re == nil && opts.JSONField == "" {
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, nil, &ParseError{Kind: ErrRead, Line: 1, Err: err}
+		}
+		stacks, err := ReadJSONStacks(bytes.NewReader(data))
+		if len(stacks) > 0 || err == nil {
+			for _, s := range stacks {
+				s.rewritePaths(opts.PathRewrites)
+			}
+			return []*Snapshot{{Line: 1, Stacks: stacks}}, nil, err
+		}
+		br = bufio.NewReaderSize(bytes.NewReader(data), PrefixSampleSize)
+		jsonErr = err
+	}
+
+	if re == nil && opts.DetectPrefix {
+		if pf, ok := DetectLinePrefix(br); ok {
+			re = regexp.MustCompile(pf.Pattern)
+		}
+	}
+
+	var cur *Stack
+	var stacks []*Stack
+	var diags []Diagnostic
+
+	// lineNo and offset are the number and starting byte offset of line.
+	var line string
+	var lineNo int
+	var offset, next int64
+	parseError := func(kind ParseErrorKind, err error) *ParseError {
+		return &ParseError{
+			Kind:   kind,
+			Line:   lineNo,
+			Offset: offset,
+			Text:   line,
+			Err:    err,
+		}
+	}
+
+	// dumps are the snapshots found so far, and starts the index in stacks
+	// of the first stack of each. seen holds the goroutine numbers in the
+	// current dump, and gap is set after a pause in the timestamps.
+	var dumps []*Snapshot
+	var starts []int
+	var seen map[int]bool
+	var gap bool
+	var lastTime time.Time
+	startDump := func() {
+		if len(starts) > 0 && starts[len(starts)-1] == len(stacks) {
+			// the current dump is still empty
+			return
+		}
+		dumps = append(dumps, &Snapshot{Line: lineNo, Time: lastTime})
+		starts = append(starts, len(stacks))
+		seen = make(map[int]bool)
+		gap = false
+	}
+	snapshots := func() []*Snapshot {
+		var out []*Snapshot
+		for i, d := range dumps {
+			end := len(stacks)
+			if i+1 < len(starts) {
+				end = starts[i+1]
+			}
+			if d.Stacks = stacks[starts[i]:end]; len(d.Stacks) > 0 {
+				out = append(out, d)
+			}
+		}
+		return out
+	}
+
 	// Catch parsing errors and recover. There's no reason to crash the entire parser.
-	// Also report the line number where the error happened.
-	lineNo := 0
 	defer func() {
 		if r := recover(); r != nil {
-			_err = fmt.Errorf("line %d: [panic] %s\n%s", lineNo, r, debug.Stack())
-		} else if _err != nil {
-			_err = fmt.Errorf("line %d: %w", lineNo, _err)
+			perr := parseError(ErrPanic, fmt.Errorf("[panic] %s", r))
+			perr.Trace = debug.Stack()
+			_snaps, _err = snapshots(), perr
 		}
 	}()
 
-	var cur *Stack
-	var stacks []*Stack
+	// frame and created are waiting for the file:line that follows them.
 	var frame *Frame
-	scan := bufio.NewScanner(r)
+	var created *CreatedBy
+
+	// inDump is set from a goroutine header until the dump is seen to end,
+	// at a signal line or other text between goroutines.
+	var inDump bool
+
+	// skipping is set while dropping the rest of a goroutine, or other
+	// lines, that couldn't be made sense of in lenient mode.
+	var skipping bool
+
+	// fail reports a problem with the current line. It returns an error in
+	// strict mode, and records a diagnostic and returns nil in lenient mode.
+	fail := func(kind ParseErrorKind, problem string) error {
+		if !opts.Lenient {
+			return parseError(kind, fmt.Errorf("%s: %q", problem, line))
+		}
+		g := -1
+		if cur != nil {
+			g = cur.Number
+		}
+		diags = append(diags, Diagnostic{
+			Kind:      kind,
+			Line:      lineNo,
+			Offset:    offset,
+			Goroutine: g,
+			Problem:   problem,
+			Text:      line,
+		})
+		return nil
+	}
+
+	// flushPending keeps a frame or created by line whose file:line is
+	// missing, e.g. because the dump was truncated.
+	flushPending := func() error {
+		switch {
+		case frame != nil:
+			if err := fail(ErrMissingFileLine, fmt.Sprintf("missing file:line for %s", frame.Function)); err != nil {
+				return err
+			}
+			cur.Frames = append(cur.Frames, *frame)
+		case created != nil:
+			if err := fail(ErrMissingFileLine, fmt.Sprintf("missing file:line for 'created by %s'", created.Function)); err != nil {
+				return err
+			}
+			cur.CreatedBy = *created
+		}
+		frame, created = nil, nil
+		return nil
+	}
+
+	finish := func() error {
+		if err := flushPending(); err != nil {
+			return err
+		}
+		if cur != nil {
+			stacks = append(stacks, cur)
+		}
+		cur = nil
+		skipping = false
+		return nil
+	}
+
+	// width is the length of the last line read including its line ending,
+	// which ScanLines drops whether it is "\n" or "\r\n".
+	var width int
+	scan := bufio.NewScanner(br)
+	scan.Buffer(nil, maxLineLength)
+	scan.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		width = advance
+		return advance, token, err
+	})
 	for scan.Scan() {
 		lineNo++
-		line := scan.Text()
+		offset = next
+		next += int64(width)
+		line = scan.Text()
 		if re != nil {
 			pref := re.Find([]byte(line))
+			if t, ok := findTimestamp(string(pref)); ok {
+				if !lastTime.IsZero() && t.Sub(lastTime) > dumpGap {
+					gap = true
+				}
+				lastTime = t
+			}
 			if len(pref) == len(line) {
 				line = ""
 			} else {
@@ -177,113 +547,180 @@ func ParseStacks(r io.Reader, linePrefix string) (_ []*Stack, _err error) {
 		}
 
 		if strings.HasPrefix(line, "goroutine") {
-			if cur != nil {
-				stacks = append(stacks, cur)
-				cur = nil
+			if err := finish(); err != nil {
+				return snapshots(), nil, err
 			}
 
-			parts := strings.Split(line, " ")
-			num, err := strconv.Atoi(parts[1])
+			s, err := ParseHeader(line)
 			if err != nil {
-				return nil, fmt.Errorf("unexpected formatting: %s", line)
-			}
-
-			var timev time.Duration
-			state := strings.Split(strings.Trim(strings.Join(parts[2:], " "), "[]:"), ",")
-			locked := false
-			// The first field is always the state. The second and
-			// third are the time and whether or not it's locked to
-			// the current thread. However, either or both of these fields can be omitted.
-			for _, s := range state[1:] {
-				if s == " locked to thread" {
-					locked = true
-					continue
-				}
-				timeparts := strings.Fields(state[1])
-				if len(timeparts) != 2 {
-					return nil, fmt.Errorf("weirdly formatted time string: %q", state[1])
+				if !opts.Lenient {
+					return snapshots(), nil, parseError(ErrHeader, err)
 				}
-
-				val, err := strconv.Atoi(timeparts[0])
-				if err != nil {
-					return nil, err
-				}
-
-				timev = time.Duration(val) * time.Minute
+				fail(ErrHeader, "malformed goroutine header")
+				skipping, inDump = true, true
+				continue
 			}
-
-			cur = &Stack{
-				Number:       num,
-				State:        state[0],
-				WaitTime:     timev,
-				ThreadLocked: locked,
+			if len(dumps) == 0 || gap || seen[s.Number] {
+				startDump()
 			}
+			seen[s.Number] = true
+			cur = s
+			inDump = true
 			continue
 		}
 		if line == "" {
 			// This can happen when we get random empty lines.
-			if cur != nil {
-				stacks = append(stacks, cur)
+			if err := finish(); err != nil {
+				return snapshots(), nil, err
 			}
-			cur = nil
 			continue
 		}
-
-		if strings.HasPrefix(line, "created by") {
-			fn := strings.TrimPrefix(line, "created by ")
-			if !scan.Scan() {
-				return nil, fmt.Errorf("no file info after 'created by' line on line %d", lineNo)
+		if isDumpBoundary(line) {
+			if err := finish(); err != nil {
+				return snapshots(), nil, err
 			}
-			file, line, entry, err := parseEntryLine(scan.Text())
-			if err != nil {
-				return nil, err
+			startDump()
+			inDump = false
+			continue
+		}
+		if cur == nil && isCrashDetail(line) {
+			continue
+		}
+		if skipping {
+			continue
+		}
+		if cur == nil {
+			// Logs have other lines before, between and after dumps, while
+			// the runtime only puts blank lines between goroutines, so
+			// anything that isn't part of one ends the dump.
+			if !inDump || !isGoroutineLine(line) {
+				inDump = false
+				continue
 			}
-			cur.CreatedBy = CreatedBy{
-				Function: fn,
-				File:     file,
-				Line:     line,
-				Entry:    entry,
+			if err := fail(ErrOrphanLine, "line is not part of a goroutine"); err != nil {
+				return snapshots(), nil, err
 			}
-		} else if frame == nil {
-			if strings.Contains(line, "...additional frames elided...") {
-				cur.FramesElided = true
+			skipping = true
+			continue
+		}
+
+		if frame != nil || created != nil {
+			file, ln, entry, err := parseEntryLine(line)
+			if err == nil {
+				file = rewritePath(file, opts.PathRewrites)
+				if frame != nil {
+					frame.File = file
+					frame.Line = ln
+					frame.Entry = entry
+					frame.setModuleInfo()
+					cur.Frames = append(cur.Frames, *frame)
+				} else {
+					created.File = file
+					created.Line = ln
+					created.Entry = entry
+					cur.CreatedBy = *created
+				}
+				frame, created = nil, nil
 				continue
 			}
+			if !opts.Lenient {
+				return snapshots(), nil, parseError(ErrFileLine, err)
+			}
+			// carry on with what we have, and read this line afresh
+			if err := flushPending(); err != nil {
+				return snapshots(), nil, err
+			}
+		}
 
-			frame = &Frame{
-				Function: line,
+		if strings.HasPrefix(line, "created by") {
+			fn := strings.TrimPrefix(line, "created by ")
+			var creator int
+			if n := strings.LastIndex(fn, " in goroutine "); n >= 0 {
+				g, err := strconv.Atoi(fn[n+len(" in goroutine "):])
+				if err != nil {
+					if err := fail(ErrCreatedBy, "unexpected formatting"); err != nil {
+						return snapshots(), nil, err
+					}
+				}
+				fn, creator = fn[:n], g
+			}
+			created = &CreatedBy{
+				Function:  fn,
+				Goroutine: creator,
 			}
+			continue
+		}
 
-			n := strings.LastIndexByte(line, '(')
-			if n > -1 {
-				frame.Function = line[:n]
-				frame.Params = strings.Split(line[n+1:len(line)-1], ", ")
+		if strings.Contains(line, "...additional frames elided...") {
+			cur.FramesElided = true
+			continue
+		}
+		if m := elidedLine.FindStringSubmatch(line); m != nil {
+			cur.ElidedAt = len(cur.Frames)
+			cur.ElidedCount, _ = strconv.Atoi(m[1])
+			continue
+		}
+		if !frameLine.MatchString(line) {
+			// the rest of the goroutine is reported as orphaned
+			if err := fail(ErrFrame, "expected a function call"); err != nil {
+				return snapshots(), nil, err
 			}
+			if err := finish(); err != nil {
+				return snapshots(), nil, err
+			}
+			continue
+		}
 
-		} else {
-			file, line, entry, err := parseEntryLine(line)
-			if err != nil {
-				return nil, err
+		frame = &Frame{
+			Function: line,
+		}
+
+		n := strings.LastIndexByte(line, '(')
+		if n > -1 {
+			frame.Function = line[:n]
+			if strings.HasSuffix(line, ")") {
+				frame.Params = strings.Split(line[n+1:len(line)-1], ", ")
 			}
-			frame.File = file
-			frame.Line = line
-			frame.Entry = entry
-			cur.Frames = append(cur.Frames, *frame)
-			frame = nil
 		}
 	}
-	if cur != nil {
-		stacks = append(stacks, cur)
+	if err := scan.Err(); err != nil {
+		return snapshots(), nil, parseError(ErrRead, err)
+	}
+	if err := finish(); err != nil {
+		return snapshots(), nil, err
 	}
+	if len(stacks) == 0 && jsonErr != nil {
+		return nil, diags, jsonErr
+	}
+
+	return snapshots(), diags, nil
+}
 
-	return stacks, nil
+// elidedLine matches the line marking frames left out of the middle of a
+// deep stack.
+var elidedLine = regexp.MustCompile(`^\.\.\.(\d+) frames elided\.\.\.$`)
+
+// frameLine matches a function call line of a goroutine, such as
+// "main.(*T).run(0xc000010000)".
+var frameLine = regexp.MustCompile(`^\S+\(.*\)$`)
+
+// isGoroutineLine reports whether line looks like it belongs to a goroutine,
+// rather than being some other output mixed in with the dump.
+func isGoroutineLine(line string) bool {
+	if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "created by ") ||
+		strings.Contains(line, "...additional frames elided...") || elidedLine.MatchString(line) ||
+		frameLine.MatchString(line) {
+		return true
+	}
+	file, _, _, err := parseEntryLine(line)
+	return err == nil && (strings.HasSuffix(file, ".go") || strings.HasPrefix(file, "<"))
 }
 
 func parseEntryLine(s string) (file string, line int64, entry int64, err error) {
 	parts := strings.Split(s, ":")
 	file = strings.Trim(parts[0], " \t\n")
 	if len(parts) != 2 {
-		return "", 0, 0, fmt.Errorf("expected a colon: %q", line)
+		return "", 0, 0, fmt.Errorf("expected a colon: %q", s)
 	}
 
 	lineAndEntry := strings.Split(parts[1], " ")
@@ -2,6 +2,7 @@ package stacks
 
 import (
 	"encoding/json"
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -34,9 +35,10 @@ created by github.com/libp2p/go-libp2p-swarm.(*Conn).doClose
 `,
 			expected: []*Stack{
 				{
-					Number:   85751948,
-					State:    "semacquire",
-					WaitTime: 25 * time.Minute,
+					Number:    85751948,
+					State:     "semacquire",
+					BaseState: "semacquire",
+					WaitTime:  25 * time.Minute,
 					Frames: []Frame{
 						{
 							Function: "sync.runtime_Semacquire",
@@ -44,6 +46,7 @@ created by github.com/libp2p/go-libp2p-swarm.(*Conn).doClose
 							File:     "/usr/local/go/src/runtime/sema.go",
 							Line:     56,
 							Entry:    69,
+							RelFile:  "runtime/sema.go",
 						},
 						{
 							Function: "sync.(*WaitGroup).Wait",
@@ -51,6 +54,7 @@ created by github.com/libp2p/go-libp2p-swarm.(*Conn).doClose
 							File:     "/usr/local/go/src/sync/waitgroup.go",
 							Line:     130,
 							Entry:    101,
+							RelFile:  "sync/waitgroup.go",
 						},
 						{
 							Function: "github.com/libp2p/go-libp2p-swarm.(*Swarm).notifyAll",
@@ -58,16 +62,22 @@ created by github.com/libp2p/go-libp2p-swarm.(*Conn).doClose
 								"0xc000783380",
 								"0xc01a77d0c0",
 							},
-							File:  "pkg/mod/github.com/libp2p/go-libp2p-swarm@v0.5.3/swarm.go",
-							Line:  553,
-							Entry: 318,
+							File:          "pkg/mod/github.com/libp2p/go-libp2p-swarm@v0.5.3/swarm.go",
+							Line:          553,
+							Entry:         318,
+							ModulePath:    "github.com/libp2p/go-libp2p-swarm",
+							ModuleVersion: "v0.5.3",
+							RelFile:       "swarm.go",
 						},
 						{
-							Function: "github.com/libp2p/go-libp2p-swarm.(*Conn).doClose.func1",
-							Params:   []string{"0xc06f36f4d0"},
-							File:     "pkg/mod/github.com/libp2p/go-libp2p-swarm@v0.5.3/swarm_conn.go",
-							Line:     84,
-							Entry:    167,
+							Function:      "github.com/libp2p/go-libp2p-swarm.(*Conn).doClose.func1",
+							Params:        []string{"0xc06f36f4d0"},
+							File:          "pkg/mod/github.com/libp2p/go-libp2p-swarm@v0.5.3/swarm_conn.go",
+							Line:          84,
+							Entry:         167,
+							ModulePath:    "github.com/libp2p/go-libp2p-swarm",
+							ModuleVersion: "v0.5.3",
+							RelFile:       "swarm_conn.go",
 						},
 					},
 					ThreadLocked: false,
@@ -105,3 +115,138 @@ created by github.com/libp2p/go-libp2p-swarm.(*Conn).doClose
 	}
 
 }
+
+const mangledInput = `goroutine 1 [running]:
+main.main()
+	/x/main.go:10 +0x1
+
+goroutine x [select]:
+main.lost()
+	/x/main.go:20 +0x1
+
+goroutine 2 [chan receive]:
+main.worker(0x1)
+main.run()
+	/x/run.go:5 +0x2
+created by main.start in goroutine 1
+	/x/main.go:3 +0x2
+
+goroutine 3 [select]:
+main.truncated()
+`
+
+func TestParseStacksLenient(t *testing.T) {
+	partial, err := ParseStacks(strings.NewReader(mangledInput), "")
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParseError parsing mangled input strictly, got %v", err)
+	}
+	if perr.Kind != ErrHeader || perr.Line != 5 || perr.Offset != 56 || perr.Text != "goroutine x [select]:" {
+		t.Errorf("unexpected error details: kind %v, line %d, offset %d, text %q", perr.Kind, perr.Line, perr.Offset, perr.Text)
+	}
+	if len(partial) != 1 || partial[0].Number != 1 {
+		t.Errorf("expected goroutine 1 to be returned with the error, got %v", partial)
+	}
+
+	// offsets count the whole line ending
+	crlf := strings.Replace(mangledInput, "\n", "\r\n", -1)
+	_, err = ParseStacks(strings.NewReader(crlf), "")
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParseError parsing CRLF input strictly, got %v", err)
+	}
+	if perr.Line != 5 || perr.Offset != 60 || perr.Text != "goroutine x [select]:" {
+		t.Errorf("unexpected error details for CRLF input: line %d, offset %d, text %q", perr.Line, perr.Offset, perr.Text)
+	}
+
+	stacks, diags, err := ParseStacksWithDiagnostics(strings.NewReader(mangledInput), ParseOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nums []int
+	for _, s := range stacks {
+		nums = append(nums, s.Number)
+	}
+	if !reflect.DeepEqual(nums, []int{1, 2, 3}) {
+		t.Fatalf("expected goroutines 1, 2 and 3, got %v", nums)
+	}
+
+	s := stacks[1]
+	if len(s.Frames) != 2 || s.Frames[0].Function != "main.worker" || s.Frames[0].File != "" || s.Frames[1].File != "/x/run.go" {
+		t.Errorf("expected goroutine 2 to keep both frames, got %+v", s.Frames)
+	}
+	if s.CreatedBy.Function != "main.start" || s.CreatedBy.Line != 3 {
+		t.Errorf("expected goroutine 2 to keep its creator, got %+v", s.CreatedBy)
+	}
+	if len(stacks[2].Frames) != 1 {
+		t.Errorf("expected the truncated frame to be kept, got %+v", stacks[2].Frames)
+	}
+
+	expected := []struct {
+		line      int
+		goroutine int
+	}{
+		{5, -1},
+		{11, 2},
+		{17, 3},
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags)
+	}
+	for i, e := range expected {
+		if diags[i].Line != e.line || diags[i].Goroutine != e.goroutine {
+			t.Errorf("expected diagnostic on line %d for goroutine %d, got %s", e.line, e.goroutine, diags[i])
+		}
+	}
+
+	_, diags, err = ParseStacksWithDiagnostics(strings.NewReader(crlf), ParseOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != len(expected) || diags[1].Offset != 166 {
+		t.Errorf("unexpected diagnostics for CRLF input: %v", diags)
+	}
+}
+
+func TestParseStacksNoiseInGoroutine(t *testing.T) {
+	const tail = "main.b()\n\t/x/main.go:20 +0x1\ncreated by main.start in goroutine 1\n\t/x/main.go:3 +0x2\n"
+	cases := []struct {
+		name  string
+		noise string
+	}{
+		{"log line", "INFO some log noise\n"},
+		{"truncated call", "main.a(0x1, 0x2\n"},
+		{"repeated file:line", "\t/x/main.go:10 +0x1\n"},
+	}
+
+	for _, c := range cases {
+		input := "goroutine 2 [select]:\nmain.a(0x1, 0x2)\n\t/x/main.go:10 +0x1\n" + c.noise + tail
+
+		_, err := ParseStacks(strings.NewReader(input), "")
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Kind != ErrFrame || perr.Line != 4 {
+			t.Errorf("%s: expected a frame error on line 4, got %v", c.name, err)
+		}
+
+		stacks, diags, err := ParseStacksWithDiagnostics(strings.NewReader(input), ParseOptions{Lenient: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stacks) != 1 || len(stacks[0].Frames) != 1 {
+			t.Errorf("%s: expected the frame before the noise to be kept, got %v", c.name, stacks)
+		}
+		if len(diags) != 2 || diags[0].Kind != ErrFrame || diags[0].Goroutine != 2 || diags[1].Kind != ErrOrphanLine || diags[1].Line != 5 {
+			t.Errorf("%s: expected the noise and the frames after it to be reported, got %v", c.name, diags)
+		}
+	}
+
+	// frames elided from the middle of a deep stack aren't noise
+	input := "goroutine 2 [running]:\nmain.rec()\n\t/x/main.go:5 +0x1\n...12 frames elided...\nmain.rec()\n\t/x/main.go:5 +0x1\n" + tail
+	stacks, err := ParseStacks(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := stacks[0]; len(s.Frames) != 3 || s.ElidedAt != 1 || s.ElidedCount != 12 || s.CreatedBy.Function != "main.start" {
+		t.Errorf("unexpected stack with elided frames: %+v", s)
+	}
+}
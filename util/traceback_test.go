@@ -0,0 +1,109 @@
+package stacks
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tracebackInput is in exactly the format the runtime prints, so writing it
+// back out must reproduce it byte for byte.
+const tracebackInput = `goroutine 1 [running]:
+main.main()
+	/build/src/github.com/me/app/main.go:10 +0x20
+
+goroutine 85751948 [semacquire, 25 minutes]:
+sync.runtime_Semacquire(0xc099422a74)
+	/usr/local/go/src/runtime/sema.go:56 +0x45
+sync.(*WaitGroup).Wait(0xc099422a74)
+	/usr/local/go/src/sync/waitgroup.go:130 +0x65
+github.com/libp2p/go-libp2p-swarm.(*Swarm).notifyAll(0xc000783380, 0xc01a77d0c0)
+	pkg/mod/github.com/libp2p/go-libp2p-swarm@v0.5.3/swarm.go:553 +0x13e
+created by github.com/libp2p/go-libp2p-swarm.(*Conn).doClose
+	pkg/mod/github.com/libp2p/go-libp2p-swarm@v0.5.3/swarm_conn.go:79 +0x16a
+
+goroutine 18 [syscall, 3 minutes, locked to thread]:
+syscall.Syscall6(0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7)
+	/usr/local/go/src/syscall/asm_linux_amd64.s:43 +0x5
+os/signal.loop()
+	/usr/local/go/src/os/signal/signal_unix.go:23 +0x25
+created by os/signal.Notify.func1.1 in goroutine 1
+	/usr/local/go/src/os/signal/signal.go:151 +0x1f
+
+goroutine 40 [chan receive (nil chan)]:
+main.deep({0x1, 0x2}, ...)
+	/build/src/github.com/me/app/deep.go:5 +0x1d
+...additional frames elided...
+created by main.start in goroutine 18
+	/build/src/github.com/me/app/main.go:3 +0x2
+
+goroutine 41 [select (no cases), 1 minutes]:
+main.forever()
+	/build/src/github.com/me/app/main.go:20
+
+goroutine 50 [running]:
+main.rec(0x3)
+	/build/src/github.com/me/app/rec.go:5 +0x1d
+...12 frames elided...
+main.rec(0x10)
+	/build/src/github.com/me/app/rec.go:5 +0x1d
+main.main()
+	/build/src/github.com/me/app/main.go:12 +0x20
+created by main.start in goroutine 1
+	/build/src/github.com/me/app/main.go:3 +0x2
+
+`
+
+func TestTracebackRoundTrip(t *testing.T) {
+	stacks, err := ParseStacks(strings.NewReader(tracebackInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTracebacks(&buf, stacks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != tracebackInput {
+		t.Fatalf("expected:\n%s\ngot:\n%s", tracebackInput, buf.String())
+	}
+
+	again, err := ParseStacks(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stacks, again) {
+		t.Fatal("parsing the written tracebacks gave different stacks")
+	}
+
+	if s := stacks[2]; !s.ThreadLocked || s.CreatedBy.Goroutine != 1 || s.CreatedBy.Function != "os/signal.Notify.func1.1" {
+		t.Fatalf("unexpected header or creator for goroutine 18: %+v", s)
+	}
+	if !stacks[3].FramesElided {
+		t.Fatal("expected goroutine 40 to have elided frames")
+	}
+	if s := stacks[5]; len(s.Frames) != 3 || s.ElidedAt != 1 || s.ElidedCount != 12 || s.CreatedBy.Function != "main.start" {
+		t.Fatalf("unexpected frames elided from the middle of goroutine 50: %+v", s)
+	}
+}
+
+func TestTracebackCollapsedFrames(t *testing.T) {
+	stacks, err := ParseStacks(strings.NewReader(simplifyInput), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collapsed := stacks[0].CollapseStdlib()
+
+	if !strings.Contains(collapsed.String(), "... 4 stdlib frames") {
+		t.Fatal("expected String to show the collapsed frames")
+	}
+
+	again, err := ParseStacks(strings.NewReader(collapsed.Traceback()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again[0].Frames) != len(collapsed.Frames) {
+		t.Fatalf("expected %d frames, got %d", len(collapsed.Frames), len(again[0].Frames))
+	}
+}